@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 const (
@@ -18,23 +19,55 @@ const (
 
 // Main is the entrypoint for the insta-assist application.
 func Main() {
-	cliFlag := flag.String("cli", defaultCLIName, "default CLI to use: codex, claude, gemini, or opencode")
-	promptFlag := flag.String("prompt", "", "prompt to send (non-interactive mode)")
-	selectFlag := flag.Int("select", -1, "auto-select option by index (0-based, use with -prompt)")
-	outputFlag := flag.String("output", "clipboard", "output mode: clipboard, stdout, or exec")
-	stayOpenExecFlag := flag.Bool("stay-open-exec", false, "when executing (Ctrl+R), keep the TUI open and show output instead of exiting")
-	yoloFlag := flag.Bool("yolo", false, "start with YOLO/auto-approve enabled")
-	versionFlag := flag.Bool("version", false, "print version and exit")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			runConfigCommand(os.Args[2:])
+			return
+		case "explain":
+			runExplainCommand(os.Args[2:])
+			return
+		case "fix":
+			runFixCommand(os.Args[2:])
+			return
+		case "sessions":
+			runSessionsCommand(os.Args[2:])
+			return
+		case "cache":
+			runCacheCommand(os.Args[2:])
+			return
+		case "init":
+			runInitCommand(os.Args[2:])
+			return
+		case "completion":
+			runCompletionCommand(os.Args[2:])
+			return
+		case "__complete":
+			runDynamicCompletion(os.Args[2:])
+			return
+		}
+	}
+
+	flags := registerFlags(flag.CommandLine)
 	flag.Parse()
 
-	if *versionFlag {
+	if flags.version {
 		fmt.Printf("insta-assist version %s\n", version)
 		os.Exit(0)
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+	if err := cfg.applyFlags(flag.CommandLine, flags); err != nil {
+		log.Fatalf("%v", err)
+	}
+	providers := configuredProviders(cfg)
+
 	// Non-interactive mode
-	if *promptFlag != "" {
-		runNonInteractive(*cliFlag, *promptFlag, *selectFlag, *outputFlag, *yoloFlag)
+	if flags.prompt != "" {
+		runNonInteractive(providers, cfg, flags.prompt, flags)
 		return
 	}
 
@@ -47,14 +80,29 @@ func Main() {
 		}
 		prompt := strings.TrimSpace(string(data))
 		if prompt != "" {
-			runNonInteractive(*cliFlag, prompt, *selectFlag, *outputFlag, *yoloFlag)
+			runNonInteractive(providers, cfg, prompt, flags)
 			return
 		}
 	}
 
 	// Interactive TUI mode
-	m := newModel(*cliFlag, *stayOpenExecFlag, *yoloFlag)
-	if _, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion()).Run(); err != nil {
+	m := newModel(providers, cfg)
+	m.input.SetValue(flags.prefill)
+	if flags.resume != "" {
+		if m, err = m.resumeSession(flags.resume); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	runTUI(m)
+}
+
+// runTUI applies the theme and runs the interactive program until it quits.
+func runTUI(m model, opts ...tea.ProgramOption) {
+	// Bubbles components pick their adaptive colors from this.
+	lipgloss.SetHasDarkBackground(m.theme.dark)
+
+	opts = append([]tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}, opts...)
+	if _, err := tea.NewProgram(m, opts...).Run(); err != nil {
 		log.Fatalf("error: %v", err)
 	}
 }
@@ -0,0 +1,240 @@
+package instassist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// cacheVersion is part of every cache key; bump it when the cached entry
+// format or the way prompts are built changes.
+const cacheVersion = "1"
+
+// cacheEntry is a provider's answer to a new prompt, stored as one file in
+// the cache directory named after its key.
+type cacheEntry struct {
+	Provider  string        `json:"provider"`
+	Prompt    string        `json:"prompt"`
+	SessionID string        `json:"session_id,omitempty"`
+	Options   []optionEntry `json:"options"`
+	Time      time.Time     `json:"time"`
+}
+
+// cacheDir returns $XDG_CACHE_HOME/insta-assist/responses, falling back to
+// ~/.cache/insta-assist/responses.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "insta-assist", "responses"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "insta-assist", "responses"), nil
+}
+
+// cacheKey identifies an answer: the same prompt, up to whitespace, sent
+// to the same provider with the same preamble, context
+// block and options schema.
+func cacheKey(provider, prompt, preamble, envBlock, schemaJSON string) string {
+	normalized := strings.Join(strings.Fields(prompt), " ")
+	schemaSum := sha256.Sum256([]byte(schemaJSON))
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		cacheVersion, provider, normalized, preamble, envBlock, hex.EncodeToString(schemaSum[:]),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCached returns the entry for key if it is younger than ttl. Expired
+// and unreadable entries are removed and count as a miss.
+func loadCached(key string, ttl time.Duration) (cacheEntry, bool) {
+	dir, err := cacheDir()
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	path := filepath.Join(dir, key+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Options) == 0 || time.Since(entry.Time) > ttl {
+		os.Remove(path)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// storeCached writes entry under key and evicts the oldest entries beyond
+// maxEntries.
+func storeCached(key string, entry cacheEntry, maxEntries int) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, key+".json")); err != nil {
+		return err
+	}
+	return pruneCache(dir, maxEntries)
+}
+
+// pruneCache removes the least recently written entries until at most
+// maxEntries remain.
+func pruneCache(dir string, maxEntries int) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) <= maxEntries {
+		return err
+	}
+	modTimes := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			modTimes[f] = info.ModTime()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return modTimes[files[i]].Before(modTimes[files[j]])
+	})
+	for _, f := range files[:len(files)-maxEntries] {
+		os.Remove(f)
+	}
+	return nil
+}
+
+// clearCache deletes every cached answer and reports how many there were.
+func clearCache() (int, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return 0, err
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err := os.RemoveAll(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// runCacheCommand implements `inst cache clear`.
+func runCacheCommand(args []string) {
+	if len(args) != 1 || args[0] != "clear" {
+		fmt.Fprintln(os.Stderr, "usage: inst cache clear")
+		os.Exit(2)
+	}
+	n, err := clearCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cache error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("removed %d cached responses\n", n)
+}
+
+// cacheable reports whether new prompts are answered from and saved to the
+// cache. Compare runs go to several providers and are never cached.
+func (m model) cacheable() bool {
+	return m.cfg.cacheTTL > 0 && !m.compare
+}
+
+// requestOptions sends content as a new prompt, answering it from the cache
+// when useCache is set and a fresh answer is stored.
+func (m model) requestOptions(content string, useCache bool) (tea.Model, tea.Cmd) {
+	key := ""
+	if m.cacheable() {
+		key = cacheKey(m.currentCLI().name(), content, m.preamble(), m.contextBlock(), m.schema.json)
+	}
+	if key != "" && useCache && !m.cfg.noCache {
+		if entry, ok := loadCached(key, m.cfg.cacheTTL); ok {
+			m.requestContent = content
+			return m.showCached(entry)
+		}
+	}
+	next, cmd := m.startRequest(m.promptFor(content, false), "")
+	nm := next.(model)
+	nm.requestContent = content
+	nm.cacheKey = key
+	return nm, cmd
+}
+
+// showCached displays a cached answer as if the provider had just sent it.
+func (m model) showCached(entry cacheEntry) (tea.Model, tea.Cmd) {
+	m.mode = modeViewing
+	m.running = false
+	m.options = entry.Options
+	m.selected = 0
+	m.lastError = nil
+	m.lastParseError = nil
+	m.rawOutput = ""
+	m.execOutput = ""
+	m.lastFailure = nil
+	m.pendingResumeID = ""
+	m.cacheKey = ""
+	m.cachedAt = entry.Time
+	if entry.SessionID != "" {
+		m.sessionIDs[entry.Provider] = entry.SessionID
+	}
+	m.status = m.helpViewing()
+	if m.autoExecute {
+		m.autoExecute = false
+		return m.useOption(m.options[0], actionExecuted)
+	}
+	return m, nil
+}
+
+// storeResponse caches the options of the request started by
+// requestOptions.
+func (m model) storeResponse(cli string, opts []optionEntry) {
+	if m.cacheKey == "" {
+		return
+	}
+	// Best-effort: a read-only cache directory only costs the speedup.
+	_ = storeCached(m.cacheKey, cacheEntry{
+		Provider:  cli,
+		Prompt:    strings.Join(m.promptHistory, "\n"),
+		SessionID: m.sessionIDs[cli],
+		Options:   opts,
+		Time:      time.Now(),
+	}, m.cfg.cacheMaxEntries)
+}
+
+// refresh sends the last new prompt again, bypassing the cache. After a
+// refine or a resumed session the prompt chain is sent as one new prompt.
+func (m model) refresh() (tea.Model, tea.Cmd) {
+	content := m.requestContent
+	if content == "" {
+		content = strings.Join(m.promptHistory, "\n")
+	}
+	if content == "" {
+		m.status = "nothing to refresh • " + m.helpViewing()
+		return m, nil
+	}
+	m.autoExecute = false
+	return m.requestOptions(content, false)
+}
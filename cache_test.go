@@ -0,0 +1,85 @@
+package instassist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKeyNormalizesPrompt(t *testing.T) {
+	base := cacheKey("codex", "list  files\nby size", "", "ctx", "{}")
+	if got := cacheKey("codex", "  list files by size ", "", "ctx", "{}"); got != base {
+		t.Errorf("expected whitespace to be ignored")
+	}
+	for name, key := range map[string]string{
+		"case":     cacheKey("codex", "list files by SIZE", "", "ctx", "{}"),
+		"provider": cacheKey("claude", "list files by size", "", "ctx", "{}"),
+		"context":  cacheKey("codex", "list files by size", "", "other", "{}"),
+		"preamble": cacheKey("codex", "list files by size", "be brief", "ctx", "{}"),
+		"schema":   cacheKey("codex", "list files by size", "", "ctx", `{"type":"object"}`),
+	} {
+		if key == base {
+			t.Errorf("expected a different %s to change the key", name)
+		}
+	}
+}
+
+func TestLoadCachedExpires(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	entry := cacheEntry{Provider: "codex", Options: []optionEntry{{Value: "ls"}}, Time: time.Now().Add(-2 * time.Hour)}
+	if err := storeCached("k", entry, 10); err != nil {
+		t.Fatalf("storeCached: %v", err)
+	}
+	if got, ok := loadCached("k", 3*time.Hour); !ok || got.Options[0].Value != "ls" {
+		t.Fatalf("expected a hit within the TTL, got %+v, %v", got, ok)
+	}
+	if _, ok := loadCached("k", time.Hour); ok {
+		t.Fatalf("expected an expired entry to miss")
+	}
+	if _, ok := loadCached("k", 3*time.Hour); ok {
+		t.Fatalf("expected the expired entry to be removed")
+	}
+}
+
+func TestStoreCachedPrunesOldest(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir, _ := cacheDir()
+	entry := cacheEntry{Provider: "codex", Options: []optionEntry{{Value: "ls"}}, Time: time.Now()}
+	for i, key := range []string{"a", "b", "c"} {
+		if err := storeCached(key, entry, 2); err != nil {
+			t.Fatalf("storeCached: %v", err)
+		}
+		// Spread the modification times so the eviction order is certain.
+		stamp := time.Now().Add(time.Duration(i-3) * time.Minute)
+		os.Chtimes(filepath.Join(dir, key+".json"), stamp, stamp)
+	}
+	if _, ok := loadCached("a", time.Hour); ok {
+		t.Errorf("expected the oldest entry to be evicted")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := loadCached(key, time.Hour); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+
+	if n, err := clearCache(); err != nil || n != 2 {
+		t.Fatalf("clearCache = %d, %v; want 2 entries removed", n, err)
+	}
+}
+
+func TestFinishEarlyCachesStreamedOptions(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	m := model{
+		cfg:       defaultConfig(),
+		keys:      defaultKeyMap(),
+		providers: []provider{cliProvider{id: "codex"}},
+		running:   true,
+		cacheKey:  "k",
+		options:   []optionEntry{{Value: "ls -S"}},
+	}
+	m = m.finishEarly()
+	if got, ok := loadCached("k", time.Hour); !ok || got.Options[0].Value != "ls -S" {
+		t.Errorf("expected the streamed options to be cached, got %+v, %v", got, ok)
+	}
+}
@@ -0,0 +1,283 @@
+package instassist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// providerResult is what one provider returned in a compare run, with its
+// options in the provider's own order.
+type providerResult struct {
+	provider  string
+	options   []optionEntry
+	sessionID string
+	err       error
+}
+
+// compareResultMsg is one provider's answer in a compare run.
+type compareResultMsg struct {
+	id     int
+	cli    string
+	output []byte
+	err    error
+}
+
+// splitCLIList parses a -cli value, which names one provider or several
+// separated by commas.
+func splitCLIList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsFold(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveProviders looks up names in providers, keeping their order.
+func resolveProviders(providers []provider, names []string) ([]provider, error) {
+	out := make([]provider, 0, len(names))
+	for _, name := range names {
+		p, ok := lookupProvider(providers, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown CLI: %s (supported: %s)", name, strings.Join(providerNames(providers), ", "))
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// riskRanks orders declared risk levels from least to most severe.
+var riskRanks = []string{"", "safe", "caution", "destructive"}
+
+func riskRank(risk string) int {
+	for i, r := range riskRanks {
+		if r == risk {
+			return i
+		}
+	}
+	return 0
+}
+
+// commandKey identifies a command for deduplication, ignoring differences
+// in whitespace only.
+func commandKey(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// mergeOptions combines the options of several providers into one list.
+// Identical commands are merged and list every provider that suggested
+// them, keeping the most severe declared risk. Commands suggested by more
+// providers rank first, then by their best position in any provider's list.
+func mergeOptions(results []providerResult) []optionEntry {
+	type merged struct {
+		opt  optionEntry
+		best int
+	}
+	var list []*merged
+	byKey := map[string]*merged{}
+	for _, r := range results {
+		for pos, opt := range r.options {
+			key := commandKey(opt.Value)
+			if m, ok := byKey[key]; ok {
+				if !containsFold(m.opt.Providers, r.provider) {
+					m.opt.Providers = append(m.opt.Providers, r.provider)
+				}
+				m.best = min(m.best, pos)
+				if riskRank(opt.Risk) > riskRank(m.opt.Risk) {
+					m.opt.Risk = opt.Risk
+				}
+				continue
+			}
+			opt.Providers = []string{r.provider}
+			m := &merged{opt: opt, best: pos}
+			byKey[key] = m
+			list = append(list, m)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if ni, nj := len(list[i].opt.Providers), len(list[j].opt.Providers); ni != nj {
+			return ni > nj
+		}
+		return list[i].best < list[j].best
+	})
+	opts := make([]optionEntry, len(list))
+	for i, m := range list {
+		opts[i] = m.opt
+		opts[i].RecommendationOrder = i + 1
+	}
+	return opts
+}
+
+// runCompare sends req to every provider at once and returns their results
+// in provider order.
+func runCompare(ctx context.Context, providers []provider, req providerRequest) []providerResult {
+	results := make([]providerResult, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := providerResult{provider: p.name()}
+			r.options, r.sessionID, r.err = queryProvider(ctx, p, req, "")
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// compareProviders returns the providers a compare run goes to: the ones
+// named with -cli a,b that are available, or every available provider.
+func (m model) compareProviders() []provider {
+	if len(m.compareCLIs) == 0 {
+		return m.providers
+	}
+	var out []provider
+	for _, name := range m.compareCLIs {
+		if p, ok := lookupProvider(m.providers, name); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *model) toggleCompare() {
+	if !m.compare && len(m.compareProviders()) < 2 {
+		m.status = "compare needs at least two available providers • " + m.helpInput()
+		return
+	}
+	m.compare = !m.compare
+	m.compareState = nil
+}
+
+// compareMark is the progress shown next to a provider's header tab while
+// comparing.
+func (m model) compareMark(name string) string {
+	switch m.compareState[name] {
+	case "running":
+		return m.theme.glyphs.spin(m.spinnerFrame) + " "
+	case "done":
+		return m.theme.glyphs.done + " "
+	case "failed":
+		return m.theme.glyphs.failed + " "
+	}
+	return m.theme.glyphs.item + " "
+}
+
+// startCompare sends fullPrompt to every compare provider concurrently;
+// each answer arrives as its own compareResultMsg.
+func (m model) startCompare(ctx context.Context, fullPrompt string) (model, []tea.Cmd) {
+	providers := m.compareProviders()
+	m.compareState = map[string]string{}
+	m.compareResults = map[string][]optionEntry{}
+	m.compareErrors = nil
+	m.comparePending = len(providers)
+
+	id := m.requestID
+	req := providerRequest{prompt: fullPrompt, yolo: m.yolo, schema: m.schema}
+	var cmds []tea.Cmd
+	for _, p := range providers {
+		m.compareState[p.name()] = "running"
+		cmds = append(cmds, func() tea.Msg {
+			out, err := sendPrompt(ctx, p, req, "")
+			return compareResultMsg{id: id, cli: p.name(), output: out, err: err}
+		})
+	}
+	m.status = fmt.Sprintf("comparing %d providers • %s", len(providers), helpRunning)
+	return m, cmds
+}
+
+func (m model) handleCompareResult(msg compareResultMsg) (tea.Model, tea.Cmd) {
+	if msg.id != m.requestID || !m.running {
+		return m, nil
+	}
+	m.comparePending--
+
+	respText := strings.TrimSpace(string(msg.output))
+	m.rawOutput += "[" + msg.cli + "]\n" + respText + "\n\n"
+	m.captureSession(msg.cli, respText)
+
+	var err error
+	opts, parseErr := extractOptions(respText)
+	switch {
+	case msg.err != nil:
+		err = msg.err
+	case parseErr != nil:
+		err = parseErr
+	}
+	if err != nil {
+		m.compareState[msg.cli] = "failed"
+		m.compareErrors = append(m.compareErrors, fmt.Errorf("%s: %w", msg.cli, err))
+	} else {
+		m.compareState[msg.cli] = "done"
+		m.compareResults[msg.cli] = opts
+	}
+
+	// Show what has arrived so far, keeping the selected command selected
+	// as the merged list reorders.
+	var selectedValue string
+	if m.selected >= 0 && m.selected < len(m.options) {
+		selectedValue = m.options[m.selected].Value
+	}
+	var results []providerResult
+	for _, p := range m.compareProviders() {
+		if opts, ok := m.compareResults[p.name()]; ok {
+			results = append(results, providerResult{provider: p.name(), options: opts})
+		}
+	}
+	m.options = mergeOptions(results)
+	m.selected = 0
+	for i, opt := range m.options {
+		if opt.Value == selectedValue {
+			m.selected = i
+		}
+	}
+
+	if m.comparePending > 0 {
+		help := helpRunning
+		if len(m.options) > 0 {
+			help = m.helpRunningOptions()
+		}
+		m.status = fmt.Sprintf("%d of %d providers answered • %s", len(m.compareState)-m.comparePending, len(m.compareState), help)
+		return m, nil
+	}
+
+	if m.cancelRequest != nil {
+		m.cancelRequest()
+		m.cancelRequest = nil
+	}
+	m.running = false
+	m.mode = modeViewing
+	m.rawOutput = strings.TrimSpace(m.rawOutput)
+	if len(m.options) == 0 {
+		m.lastError = errors.Join(m.compareErrors...)
+		m.status = fmt.Sprintf("all providers failed • %s", m.helpViewing())
+		return m, nil
+	}
+	m.status = m.helpViewing()
+	for _, p := range m.compareProviders() {
+		m.saveCurrentSession(p.name())
+	}
+	if len(m.compareErrors) > 0 {
+		var failed []string
+		for _, p := range m.compareProviders() {
+			if m.compareState[p.name()] == "failed" {
+				failed = append(failed, p.name())
+			}
+		}
+		m.status = fmt.Sprintf("%s no options from %s • %s", m.theme.glyphs.warn, strings.Join(failed, ", "), m.helpViewing())
+	}
+	if m.autoExecute {
+		m.autoExecute = false
+		return m.useOption(m.options[0], actionExecuted)
+	}
+	return m, nil
+}
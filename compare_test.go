@@ -0,0 +1,78 @@
+package instassist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeOptions(t *testing.T) {
+	results := []providerResult{
+		{provider: "codex", options: []optionEntry{
+			{Value: "find . -name '*.go'", Description: "find"},
+			{Value: "ls  -la", Description: "list"},
+			{Value: "rm -rf build", Risk: "caution"},
+		}},
+		{provider: "claude", options: []optionEntry{
+			{Value: "rm -rf build", Risk: "destructive"},
+			{Value: "ls -la", Description: "list all"},
+			{Value: "fd -e go"},
+		}},
+	}
+
+	got := mergeOptions(results)
+	var values []string
+	for _, opt := range got {
+		values = append(values, opt.Value)
+	}
+	// Shared commands first (by best position), then the rest.
+	want := []string{"rm -rf build", "ls  -la", "find . -name '*.go'", "fd -e go"}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("order = %q, want %q", values, want)
+	}
+	if !reflect.DeepEqual(got[0].Providers, []string{"codex", "claude"}) {
+		t.Fatalf("providers = %v, want codex and claude", got[0].Providers)
+	}
+	if got[0].Risk != "destructive" {
+		t.Fatalf("expected the most severe declared risk, got %q", got[0].Risk)
+	}
+	if got[1].Description != "list" {
+		t.Fatalf("expected the first provider's description, got %q", got[1].Description)
+	}
+	if !reflect.DeepEqual(got[3].Providers, []string{"claude"}) {
+		t.Fatalf("providers = %v, want claude", got[3].Providers)
+	}
+	for i, opt := range got {
+		if opt.RecommendationOrder != i+1 {
+			t.Fatalf("option %d has recommendation_order %d", i, opt.RecommendationOrder)
+		}
+	}
+}
+
+func TestSplitCLIList(t *testing.T) {
+	if got := splitCLIList(" codex, claude ,,Codex"); !reflect.DeepEqual(got, []string{"codex", "claude"}) {
+		t.Fatalf("splitCLIList = %q", got)
+	}
+}
+
+func TestRefineAfterCompareDropsMarks(t *testing.T) {
+	m := model{
+		cfg:          defaultConfig(),
+		keys:         defaultKeyMap(),
+		theme:        darkTheme(),
+		providers:    []provider{cliProvider{id: "codex"}, cliProvider{id: "claude"}},
+		compare:      true,
+		compareState: map[string]string{"codex": "done", "claude": "failed"},
+		sessionIDs:   map[string]string{},
+	}
+	m.theme.glyphs = unicodeGlyphs()
+
+	// A refine resumes one provider's session instead of comparing.
+	next, _ := m.startRequest("only staged files", "sess-1")
+	m = next.(model)
+	if m.compareState != nil {
+		t.Fatalf("expected the compare marks to be cleared, got %v", m.compareState)
+	}
+	if mark := m.compareMark("claude"); mark != m.theme.glyphs.item+" " {
+		t.Errorf("expected no compare mark, got %q", mark)
+	}
+}
@@ -0,0 +1,259 @@
+package instassist
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// subcommands are completed as the first argument, with their own argument
+// values.
+var subcommands = []struct {
+	name string
+	args []string
+}{
+	{"config", []string{"show"}},
+	{"explain", nil},
+	{"fix", nil},
+	{"sessions", nil},
+	{"cache", []string{"clear"}},
+	{"init", []string{"zsh", "bash", "fish"}},
+	{"completion", []string{"bash", "zsh", "fish"}},
+}
+
+// completionFlag is a flag as the completion scripts see it.
+type completionFlag struct {
+	name    string
+	usage   string
+	isBool  bool
+	values  []string // fixed values, completed as-is
+	dynamic string   // `inst __complete <dynamic>` lists the values at completion time
+}
+
+// completionFlags describes every registered flag, so the scripts cannot
+// drift from the flag set.
+func completionFlags() []completionFlag {
+	fs := flag.NewFlagSet("inst", flag.ContinueOnError)
+	registerFlags(fs)
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{name: f.Name, usage: shortUsage(f.Usage)}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.isBool = true
+		}
+		switch f.Name {
+		case "cli":
+			cf.dynamic = "cli"
+		case "session", "resume":
+			cf.dynamic = "sessions"
+		case "mode":
+			cf.dynamic = "modes"
+		case "theme":
+			cf.dynamic = "themes"
+		case "output":
+			cf.values = append(append([]string(nil), outputModes...), "fd:3")
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+// parenthetical matches asides like "(non-interactive mode)" in usages.
+var parenthetical = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// shortUsage keeps the first clause of a flag's usage, without asides, for
+// descriptions.
+func shortUsage(usage string) string {
+	usage = parenthetical.ReplaceAllString(usage, "")
+	for _, sep := range []string{": ", "; "} {
+		if i := strings.Index(usage, sep); i > 0 {
+			usage = usage[:i]
+		}
+	}
+	return usage
+}
+
+func runCompletionCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: inst completion bash|zsh|fish")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, completionFlags())
+	case "zsh":
+		writeZshCompletion(os.Stdout, completionFlags())
+	case "fish":
+		writeFishCompletion(os.Stdout, completionFlags())
+	default:
+		fmt.Fprintln(os.Stderr, "usage: inst completion bash|zsh|fish")
+		os.Exit(2)
+	}
+}
+
+// runDynamicCompletion backs the hidden `inst __complete` subcommand the
+// scripts call for values that depend on the machine.
+func runDynamicCompletion(args []string) {
+	if len(args) != 1 {
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "sessions":
+		fmt.Println("last")
+		records, _ := loadSessions()
+		for i := len(records) - 1; i >= 0; i-- {
+			fmt.Println(records[i].ID)
+		}
+		return
+	case "cli", "modes", "themes":
+	default:
+		os.Exit(2)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		cfg = defaultConfig()
+	}
+	if args[0] == "modes" {
+		for _, name := range modeNames(cfg.modes) {
+			fmt.Println(name)
+		}
+		return
+	}
+	if args[0] == "themes" {
+		for _, name := range cfg.themeNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+	for _, p := range availableProviders(configuredProviders(cfg)) {
+		fmt.Println(p.name())
+	}
+}
+
+func subcommandNames() []string {
+	names := make([]string, len(subcommands))
+	for i, sc := range subcommands {
+		names[i] = sc.name
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	var names, valueFlags []string
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+		if !f.isBool && f.dynamic == "" && f.values == nil {
+			valueFlags = append(valueFlags, "-"+f.name)
+		}
+	}
+
+	fmt.Fprintln(w, "# bash completion for inst. Add to ~/.bashrc: eval \"$(inst completion bash)\"")
+	fmt.Fprintln(w, "_inst() {")
+	fmt.Fprintln(w, "  local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}")
+	fmt.Fprintln(w, "  case $prev in")
+	for _, f := range flags {
+		switch {
+		case f.dynamic != "":
+			fmt.Fprintf(w, "    -%s) COMPREPLY=($(compgen -W \"$(inst __complete %s 2>/dev/null)\" -- \"$cur\")); return ;;\n", f.name, f.dynamic)
+		case f.values != nil:
+			fmt.Fprintf(w, "    -%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.name, strings.Join(f.values, " "))
+		}
+	}
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(w, "    %s) return ;;\n", strings.Join(valueFlags, "|"))
+	}
+	fmt.Fprintln(w, "  esac")
+	fmt.Fprintln(w, "  if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W %q -- \"$cur\")); return\n", strings.Join(subcommandNames(), " "))
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintln(w, "  if [[ $COMP_CWORD -eq 2 ]]; then")
+	fmt.Fprintln(w, "    case ${COMP_WORDS[1]} in")
+	for _, sc := range subcommands {
+		fmt.Fprintf(w, "      %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", sc.name, strings.Join(sc.args, " "))
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintf(w, "  COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _inst inst")
+}
+
+// zshQuote escapes text for an _arguments spec inside single quotes.
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, "'", `'\''`)
+	for _, c := range []string{"[", "]", ":"} {
+		s = strings.ReplaceAll(s, c, `\`+c)
+	}
+	return s
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "#compdef inst")
+	fmt.Fprintln(w, "# zsh completion for inst. Add to ~/.zshrc: eval \"$(inst completion zsh)\"")
+	fmt.Fprintln(w, "_inst_dynamic() {")
+	fmt.Fprintln(w, "  local -a values")
+	fmt.Fprintln(w, "  values=(${(f)\"$(inst __complete $1 2>/dev/null)\"})")
+	fmt.Fprintln(w, "  compadd -a values")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "_inst() {")
+	fmt.Fprintln(w, "  local state")
+	fmt.Fprintln(w, "  _arguments \\")
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.name, zshQuote(f.usage))
+		switch {
+		case f.isBool:
+		case f.dynamic != "":
+			spec += fmt.Sprintf(":%s:{_inst_dynamic %s}", f.name, f.dynamic)
+		case f.values != nil:
+			values := make([]string, len(f.values))
+			for i, v := range f.values {
+				values[i] = zshQuote(v)
+			}
+			spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(values, " "))
+		default:
+			spec += fmt.Sprintf(":%s: ", f.name)
+		}
+		fmt.Fprintf(w, "    '%s' \\\n", spec)
+	}
+	fmt.Fprintf(w, "    '1:command:(%s)' \\\n", strings.Join(subcommandNames(), " "))
+	fmt.Fprintln(w, "    '2:argument:->argument'")
+	fmt.Fprintln(w, "  if [[ $state == argument ]]; then")
+	fmt.Fprintln(w, "    case $words[2] in")
+	for _, sc := range subcommands {
+		fmt.Fprintf(w, "      %s) compadd %s ;;\n", sc.name, strings.Join(sc.args, " "))
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _inst inst")
+}
+
+// fishQuote single-quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "# fish completion for inst. Add to ~/.config/fish/config.fish: inst completion fish | source")
+	fmt.Fprintln(w, "complete -c inst -f")
+	fmt.Fprintf(w, "complete -c inst -n __fish_use_subcommand -a %s\n", fishQuote(strings.Join(subcommandNames(), " ")))
+	for _, sc := range subcommands {
+		fmt.Fprintf(w, "complete -c inst -n '__fish_seen_subcommand_from %s' -a %s\n", sc.name, fishQuote(strings.Join(sc.args, " ")))
+	}
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c inst -o %s -d %s", f.name, fishQuote(f.usage))
+		switch {
+		case f.isBool:
+		case f.dynamic != "":
+			line += fmt.Sprintf(" -x -a '(inst __complete %s 2>/dev/null)'", f.dynamic)
+		case f.values != nil:
+			line += " -x -a " + fishQuote(strings.Join(f.values, " "))
+		default:
+			line += " -x"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
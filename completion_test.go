@@ -0,0 +1,48 @@
+package instassist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScriptsCoverEveryFlag(t *testing.T) {
+	flags := completionFlags()
+	writers := map[string]func(*bytes.Buffer){
+		"bash": func(b *bytes.Buffer) { writeBashCompletion(b, flags) },
+		"zsh":  func(b *bytes.Buffer) { writeZshCompletion(b, flags) },
+		"fish": func(b *bytes.Buffer) { writeFishCompletion(b, flags) },
+	}
+	for shell, write := range writers {
+		var b bytes.Buffer
+		write(&b)
+		script := b.String()
+		for _, f := range flags {
+			if !strings.Contains(script, "-"+f.name) && !strings.Contains(script, "-o "+f.name) {
+				t.Errorf("%s completion is missing -%s", shell, f.name)
+			}
+		}
+		for _, mode := range outputModes {
+			if !strings.Contains(script, mode) {
+				t.Errorf("%s completion is missing output mode %s", shell, mode)
+			}
+		}
+		if !strings.Contains(script, "__complete cli") && !strings.Contains(script, "_inst_dynamic cli") {
+			t.Errorf("%s completion does not complete -cli dynamically", shell)
+		}
+	}
+}
+
+func TestShortUsage(t *testing.T) {
+	cases := map[string]string{
+		"output mode: clipboard, stdout":                                  "output mode",
+		"when executing (Ctrl+R), keep the TUI open and show output":      "when executing, keep the TUI open and show output",
+		"provider to use: codex; a comma-separated list compares several": "provider to use",
+		"auto-select option by index (0-based, use with -prompt)":         "auto-select option by index",
+	}
+	for usage, want := range cases {
+		if got := shortUsage(usage); got != want {
+			t.Errorf("shortUsage(%q) = %q, want %q", usage, got, want)
+		}
+	}
+}
@@ -0,0 +1,624 @@
+package instassist
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	projectConfigName = ".instassist.toml"
+	defaultTimeout    = 5 * time.Minute
+	defaultCacheTTL   = 24 * time.Hour
+	defaultCacheMax   = 500
+	sourceDefault     = "default"
+)
+
+// fileConfig mirrors config.toml and .instassist.toml. Pointer fields
+// distinguish "not set" from zero values so layers can be merged.
+type fileConfig struct {
+	DefaultCLI   *string                `toml:"default_cli"`
+	CLIOrder     []string               `toml:"cli_order"`
+	Timeout      *string                `toml:"timeout"`
+	Output       *string                `toml:"output"`
+	Yolo         *bool                  `toml:"yolo"`
+	StayOpenExec *bool                  `toml:"stay_open_exec"`
+	Preamble     *string                `toml:"preamble"`
+	Mode         *string                `toml:"mode"`
+	Context      *bool                  `toml:"context"`
+	Theme        *string                `toml:"theme"`
+	ASCII        *bool                  `toml:"ascii"`
+	Themes       map[string]themeConfig `toml:"themes"`
+	CacheTTL     *string                `toml:"cache_ttl"`
+	CacheMax     *int                   `toml:"cache_max_entries"`
+	Keys         map[string]keyList     `toml:"keys"`
+	Providers    []customProviderConfig `toml:"providers"`
+}
+
+// config is the effective configuration after merging defaults, the user
+// config file, the project config file and command-line flags, in that
+// order of increasing precedence.
+type config struct {
+	defaultCLI   string
+	cliOrder     []string
+	timeout      time.Duration
+	output       string
+	yolo         bool
+	stayOpenExec bool
+	preamble     string
+	mode         string
+	context      bool
+	theme        string
+	ascii        bool
+	providers    []customProviderConfig
+
+	// themes are the user themes from [themes.<name>] tables.
+	themes map[string]themeConfig
+
+	// modes are the built-in prompt modes with the user's mode files
+	// applied; mode names the selected one, if any.
+	modes []promptMode
+
+	// keys is the default keymap with the [keys] table applied.
+	keys keyMap
+
+	// Response cache: how long answers stay fresh (0 disables the cache)
+	// and how many are kept. noCache is set by -no-cache.
+	cacheTTL        time.Duration
+	cacheMaxEntries int
+	noCache         bool
+
+	// compareCLIs lists the providers of a -cli a,b compare run.
+	compareCLIs []string
+
+	// allowDangerous is only settable by flag so that a config file cannot
+	// silently disable the destructive-command confirmation.
+	allowDangerous bool
+
+	// sources maps each config key to where its value came from.
+	sources map[string]string
+}
+
+var outputModes = []string{"clipboard", "stdout", "exec", "json", "jsonl"}
+
+func defaultConfig() config {
+	cfg := config{
+		defaultCLI: defaultCLIName,
+		timeout:    defaultTimeout,
+		output:     "clipboard",
+		theme:      "auto",
+		sources:    map[string]string{},
+		modes:      builtinModes(),
+		keys:       defaultKeyMap(),
+
+		cacheTTL:        defaultCacheTTL,
+		cacheMaxEntries: defaultCacheMax,
+	}
+	for _, key := range configKeys {
+		cfg.sources[key] = sourceDefault
+	}
+	return cfg
+}
+
+var configKeys = []string{"default_cli", "cli_order", "timeout", "output", "yolo", "stay_open_exec", "preamble", "mode", "context", "theme", "ascii", "cache_ttl", "cache_max_entries", "keys", "themes", "providers"}
+
+// configDir returns $XDG_CONFIG_HOME/insta-assist, falling back to
+// ~/.config/insta-assist.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "insta-assist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "insta-assist"), nil
+}
+
+func modesDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, modesDirName), nil
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// findProjectConfig walks up from dir looking for .instassist.toml.
+func findProjectConfig(dir string) string {
+	for {
+		candidate := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfig merges the defaults with the user config and the nearest
+// project config. Missing files are not an error.
+func loadConfig() (config, error) {
+	cfg := defaultConfig()
+
+	if dir, err := modesDir(); err == nil {
+		modes, err := loadModes(dir)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.modes = modes
+	}
+
+	if path, err := configPath(); err == nil {
+		layer, found, err := loadConfigFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if found {
+			if err := cfg.merge(layer, path); err != nil {
+				return cfg, err
+			}
+		}
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		if path := findProjectConfig(cwd); path != "" {
+			layer, _, err := loadConfigFile(path)
+			if err != nil {
+				return cfg, err
+			}
+			if err := checkProjectLayer(layer); err != nil {
+				return cfg, fmt.Errorf("%s: %w", path, err)
+			}
+			if err := cfg.merge(layer, path); err != nil {
+				return cfg, err
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// checkProjectLayer rejects the settings a checked-out repository must not
+// control: commands that insta-assist will run, and running suggestions
+// without the user looking at them.
+func checkProjectLayer(layer fileConfig) error {
+	var denied []string
+	if len(layer.Providers) > 0 {
+		denied = append(denied, "providers")
+	}
+	if layer.Yolo != nil && *layer.Yolo {
+		denied = append(denied, "yolo")
+	}
+	if layer.StayOpenExec != nil && *layer.StayOpenExec {
+		denied = append(denied, "stay_open_exec")
+	}
+	if layer.Output != nil && strings.EqualFold(*layer.Output, "exec") {
+		denied = append(denied, "output = \"exec\"")
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%s can only be set in the user config", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+func loadConfigFile(path string) (fileConfig, bool, error) {
+	var layer fileConfig
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return layer, false, nil
+	}
+	if err != nil {
+		return layer, false, err
+	}
+	if err := parseConfig(string(data), &layer); err != nil {
+		return layer, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return layer, true, nil
+}
+
+func parseConfig(data string, layer *fileConfig) error {
+	md, err := toml.Decode(data, layer)
+	if err != nil {
+		return err
+	}
+	// A misspelled key would otherwise be ignored without a word.
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		k := undecoded[0]
+		if len(k) == 1 {
+			return fmt.Errorf("unknown key %q (valid: %s)", k.String(), strings.Join(configKeys, ", "))
+		}
+		return fmt.Errorf("unknown key %q", k.String())
+	}
+	for i, p := range layer.Providers {
+		if p.Name == "" {
+			return fmt.Errorf("providers[%d]: name is required", i)
+		}
+		if p.Command == "" {
+			return fmt.Errorf("provider %q: command is required", p.Name)
+		}
+		switch p.PromptInput {
+		case "", "argv", "stdin":
+		default:
+			return fmt.Errorf("provider %q: prompt_input must be \"argv\" or \"stdin\"", p.Name)
+		}
+		if p.SessionPattern != "" {
+			if _, err := regexp.Compile(p.SessionPattern); err != nil {
+				return fmt.Errorf("provider %q: invalid session_pattern: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// merge applies the values set in layer on top of cfg.
+func (cfg *config) merge(layer fileConfig, source string) error {
+	if layer.DefaultCLI != nil {
+		cfg.defaultCLI = *layer.DefaultCLI
+		cfg.sources["default_cli"] = source
+	}
+	if layer.CLIOrder != nil {
+		cfg.cliOrder = layer.CLIOrder
+		cfg.sources["cli_order"] = source
+	}
+	if layer.Timeout != nil {
+		d, err := time.ParseDuration(*layer.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s: invalid timeout %q", source, *layer.Timeout)
+		}
+		cfg.timeout = d
+		cfg.sources["timeout"] = source
+	}
+	if layer.Output != nil {
+		if !validOutputMode(*layer.Output) {
+			return fmt.Errorf("%s: invalid output %q (valid: %s, fd:N)", source, *layer.Output, strings.Join(outputModes, ", "))
+		}
+		cfg.output = strings.ToLower(*layer.Output)
+		cfg.sources["output"] = source
+	}
+	if layer.Yolo != nil {
+		cfg.yolo = *layer.Yolo
+		cfg.sources["yolo"] = source
+	}
+	if layer.StayOpenExec != nil {
+		cfg.stayOpenExec = *layer.StayOpenExec
+		cfg.sources["stay_open_exec"] = source
+	}
+	if layer.Preamble != nil {
+		cfg.preamble = *layer.Preamble
+		cfg.sources["preamble"] = source
+	}
+	if layer.Mode != nil {
+		if err := cfg.setMode(*layer.Mode); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		cfg.sources["mode"] = source
+	}
+	if layer.Context != nil {
+		cfg.context = *layer.Context
+		cfg.sources["context"] = source
+	}
+	// Themes first, so the theme can name one defined in the same file.
+	if len(layer.Themes) > 0 {
+		if err := cfg.addThemes(layer.Themes); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		cfg.sources["themes"] = source
+	}
+	if layer.Theme != nil {
+		if err := cfg.setTheme(*layer.Theme); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		cfg.sources["theme"] = source
+	}
+	if layer.ASCII != nil {
+		cfg.ascii = *layer.ASCII
+		cfg.sources["ascii"] = source
+	}
+	if layer.CacheTTL != nil {
+		d, err := time.ParseDuration(*layer.CacheTTL)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s: invalid cache_ttl %q", source, *layer.CacheTTL)
+		}
+		cfg.cacheTTL = d
+		cfg.sources["cache_ttl"] = source
+	}
+	if layer.CacheMax != nil {
+		if *layer.CacheMax < 1 {
+			return fmt.Errorf("%s: cache_max_entries must be at least 1", source)
+		}
+		cfg.cacheMaxEntries = *layer.CacheMax
+		cfg.sources["cache_max_entries"] = source
+	}
+	if len(layer.Keys) > 0 {
+		if err := cfg.keys.rebind(layer.Keys); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		cfg.sources["keys"] = source
+	}
+	if len(layer.Providers) > 0 {
+		cfg.providers = append(cfg.providers, layer.Providers...)
+		cfg.sources["providers"] = source
+	}
+	return nil
+}
+
+// cliFlags holds the values of the command-line flags.
+type cliFlags struct {
+	cli            string
+	prompt         string
+	prefill        string
+	session        string
+	resume         string
+	mode           string
+	theme          string
+	selectIndex    int
+	output         string
+	stayOpenExec   bool
+	yolo           bool
+	ascii          bool
+	allowDangerous bool
+	noContext      bool
+	noCache        bool
+	retryOnFailure int
+	params         paramValues
+	version        bool
+}
+
+func registerFlags(fs *flag.FlagSet) *cliFlags {
+	f := &cliFlags{params: paramValues{}}
+	fs.StringVar(&f.cli, "cli", defaultCLIName, "provider to use: "+strings.Join(providerNames(builtinProviders()), ", ")+", or a custom provider; a comma-separated list compares several")
+	fs.StringVar(&f.prompt, "prompt", "", "prompt to send (non-interactive mode)")
+	fs.StringVar(&f.prefill, "prefill", "", "start the TUI with this text in the prompt input")
+	fs.StringVar(&f.session, "session", "", "continue a session: a stored session ID, a prefix of one, last, or a raw provider session ID (non-interactive mode)")
+	fs.StringVar(&f.resume, "resume", "", "reopen a stored session in the TUI: its ID, a prefix of one, or last")
+	fs.StringVar(&f.mode, "mode", "", "prompt mode: "+strings.Join(modeNames(builtinModes()), ", ")+", or a mode file in the config dir")
+	fs.IntVar(&f.selectIndex, "select", -1, "auto-select option by index (0-based, use with -prompt)")
+	fs.StringVar(&f.output, "output", "clipboard", "output mode: "+strings.Join(outputModes, ", ")+", or fd:N to write the selection to file descriptor N")
+	fs.StringVar(&f.theme, "theme", "", "color theme: "+strings.Join(builtinThemeNames, ", ")+", or a theme defined in config")
+	fs.BoolVar(&f.ascii, "ascii", false, "draw ASCII symbols instead of emoji and box-drawing characters")
+	fs.BoolVar(&f.stayOpenExec, "stay-open-exec", false, "when executing (Ctrl+R), keep the TUI open and show output instead of exiting")
+	fs.BoolVar(&f.yolo, "yolo", false, "start with YOLO/auto-approve enabled")
+	fs.BoolVar(&f.allowDangerous, "allow-dangerous", false, "run commands flagged as destructive without asking for confirmation")
+	fs.IntVar(&f.retryOnFailure, "retry-on-failure", 0, "with -output exec, send a failed command back to the AI and retry up to N times")
+	fs.BoolVar(&f.noContext, "no-context", false, "do not add OS, shell, cwd, git and tool context to prompts")
+	fs.BoolVar(&f.noCache, "no-cache", false, "always ask the provider instead of answering repeated prompts from the cache")
+	fs.Var(f.params, "param", "fill an option parameter as name=value (repeatable, non-interactive mode)")
+	fs.BoolVar(&f.version, "version", false, "print version and exit")
+	return f
+}
+
+// applyFlags overrides cfg with the flags explicitly set on the command line.
+func (cfg *config) applyFlags(fs *flag.FlagSet, f *cliFlags) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		source := "flag -" + fl.Name
+		switch fl.Name {
+		case "cli":
+			names := splitCLIList(f.cli)
+			if len(names) == 0 {
+				err = fmt.Errorf("-cli needs a provider name")
+				return
+			}
+			cfg.defaultCLI = names[0]
+			cfg.sources["default_cli"] = source
+			if len(names) > 1 {
+				cfg.compareCLIs = names
+			}
+		case "mode":
+			if err = cfg.setMode(f.mode); err != nil {
+				return
+			}
+			cfg.sources["mode"] = source
+		case "output":
+			if !validOutputMode(f.output) {
+				err = fmt.Errorf("unknown output mode: %s (valid: %s, fd:N)", f.output, strings.Join(outputModes, ", "))
+				return
+			}
+			cfg.output = strings.ToLower(f.output)
+			cfg.sources["output"] = source
+		case "theme":
+			if err = cfg.setTheme(f.theme); err != nil {
+				return
+			}
+			cfg.sources["theme"] = source
+		case "ascii":
+			cfg.ascii = f.ascii
+			cfg.sources["ascii"] = source
+		case "yolo":
+			cfg.yolo = f.yolo
+			cfg.sources["yolo"] = source
+		case "stay-open-exec":
+			cfg.stayOpenExec = f.stayOpenExec
+			cfg.sources["stay_open_exec"] = source
+		case "allow-dangerous":
+			cfg.allowDangerous = f.allowDangerous
+		case "no-cache":
+			cfg.noCache = f.noCache
+		case "no-context":
+			if f.noContext {
+				cfg.context = false
+				cfg.sources["context"] = source
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// A mode's provider is used unless -cli picks one.
+	if pm, ok := cfg.currentMode(); ok && pm.CLI != "" && cfg.sources["default_cli"] != "flag -cli" {
+		cfg.defaultCLI = pm.CLI
+		cfg.sources["default_cli"] = "mode " + pm.Name
+	}
+	return nil
+}
+
+// setMode selects the prompt mode called name; "" selects none.
+func (cfg *config) setMode(name string) error {
+	if name == "" {
+		cfg.mode = ""
+		return nil
+	}
+	pm, ok := lookupMode(cfg.modes, name)
+	if !ok {
+		return fmt.Errorf("unknown mode %q (available: %s)", name, strings.Join(modeNames(cfg.modes), ", "))
+	}
+	cfg.mode = pm.Name
+	return nil
+}
+
+// currentMode returns the selected prompt mode.
+func (cfg config) currentMode() (promptMode, bool) {
+	if cfg.mode == "" {
+		return promptMode{}, false
+	}
+	return lookupMode(cfg.modes, cfg.mode)
+}
+
+// configuredProviders returns the built-in providers with custom providers
+// from the config applied, ordered by cli_order. A custom provider replaces
+// a built-in one with the same name; others are appended in config order.
+func configuredProviders(cfg config) []provider {
+	providers := builtinProviders()
+	for _, pc := range cfg.providers {
+		custom := newCustomProvider(pc)
+		replaced := false
+		for i, p := range providers {
+			if p.name() == custom.name() {
+				providers[i] = custom
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			providers = append(providers, custom)
+		}
+	}
+	return orderProviders(providers, cfg.cliOrder)
+}
+
+// orderProviders moves the providers named in order to the front, keeping
+// the relative order of the rest.
+func orderProviders(providers []provider, order []string) []provider {
+	if len(order) == 0 {
+		return providers
+	}
+	rank := func(p provider) int {
+		for i, name := range order {
+			if strings.EqualFold(name, p.name()) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sorted := append([]provider(nil), providers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// runConfigCommand implements `inst config show [flags]`.
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "usage: inst config show [flags]")
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("inst config show", flag.ExitOnError)
+	f := registerFlags(fs)
+	fs.Parse(args[1:])
+	if err := cfg.applyFlags(fs, f); err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+
+	writeConfig(os.Stdout, cfg, providerNames(configuredProviders(cfg)))
+}
+
+// writeConfig prints the effective config as TOML with the source of each
+// value as a trailing comment.
+func writeConfig(w io.Writer, cfg config, providers []string) {
+	custom := make([]string, 0, len(cfg.providers))
+	for _, p := range cfg.providers {
+		custom = append(custom, p.Name)
+	}
+
+	values := map[string]string{
+		"default_cli":       strconv.Quote(cfg.defaultCLI),
+		"cli_order":         quoteList(cfg.cliOrder),
+		"timeout":           strconv.Quote(cfg.timeout.String()),
+		"output":            strconv.Quote(cfg.output),
+		"yolo":              strconv.FormatBool(cfg.yolo),
+		"stay_open_exec":    strconv.FormatBool(cfg.stayOpenExec),
+		"preamble":          strconv.Quote(cfg.preamble),
+		"mode":              strconv.Quote(cfg.mode),
+		"context":           strconv.FormatBool(cfg.context),
+		"theme":             strconv.Quote(cfg.theme),
+		"ascii":             strconv.FormatBool(cfg.ascii),
+		"cache_ttl":         strconv.Quote(cfg.cacheTTL.String()),
+		"cache_max_entries": strconv.Itoa(cfg.cacheMaxEntries),
+		"keys":              cfg.keys.inlineTable(),
+		"themes":            quoteList(cfg.userThemeNames()),
+		"providers":         quoteList(custom),
+	}
+
+	width := 0
+	for _, key := range configKeys {
+		if l := len(key) + 3 + len(values[key]); l > width {
+			width = l
+		}
+	}
+	for _, key := range configKeys {
+		line := key + " = " + values[key]
+		fmt.Fprintf(w, "%-*s  # %s\n", width, line, cfg.sources[key])
+	}
+	fmt.Fprintf(w, "\n# provider order: %s\n", strings.Join(providers, ", "))
+	fmt.Fprintf(w, "# modes: %s\n", strings.Join(modeNames(cfg.modes), ", "))
+	for _, conflict := range cfg.keys.conflicts() {
+		fmt.Fprintf(w, "# key conflict: %s\n", conflict)
+	}
+}
+
+func quoteList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, v := range list {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
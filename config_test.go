@@ -0,0 +1,240 @@
+package instassist
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const customProvidersTOML = `
+[[providers]]
+name = "llm"
+command = "llm"
+args = ["{yolo}", "--schema", "{schema_json}", "{prompt}"]
+resume_args = ["--cid", "{session_id}", "{prompt}"]
+yolo_flag = "--no-confirm"
+session_pattern = "conversation: (\\S+)"
+
+[[providers]]
+name = "sgpt"
+command = "sgpt"
+args = ["--no-interaction"]
+prompt_input = "stdin"
+`
+
+func TestParseConfigCustomProviders(t *testing.T) {
+	var layer fileConfig
+	if err := parseConfig(customProvidersTOML, &layer); err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	if len(layer.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(layer.Providers))
+	}
+
+	cfg := defaultConfig()
+	if err := cfg.merge(layer, "test"); err != nil {
+		t.Fatalf("merge returned error: %v", err)
+	}
+	providers := configuredProviders(cfg)
+	names := strings.Join(providerNames(providers), ",")
+	if !strings.HasSuffix(names, ",llm,sgpt") {
+		t.Fatalf("expected custom providers appended after built-ins, got %s", names)
+	}
+}
+
+func TestParseConfigRejectsInvalidProviders(t *testing.T) {
+	tests := map[string]string{
+		"missing name":    "[[providers]]\ncommand = \"x\"\n",
+		"missing command": "[[providers]]\nname = \"x\"\n",
+		"bad input":       "[[providers]]\nname = \"x\"\ncommand = \"x\"\nprompt_input = \"file\"\n",
+		"bad pattern":     "[[providers]]\nname = \"x\"\ncommand = \"x\"\nsession_pattern = \"(\"\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cfg fileConfig
+			if err := parseConfig(data, &cfg); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestCustomProviderArgs(t *testing.T) {
+	var cfg fileConfig
+	if err := parseConfig(customProvidersTOML, &cfg); err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	llm := newCustomProvider(cfg.Providers[0])
+	sgpt := newCustomProvider(cfg.Providers[1])
+	req := providerRequest{prompt: "list files", schema: schemaSpec{path: "/tmp/s.json", json: "{}"}}
+
+	args, stdin := llm.args(req, "")
+	if want := []string{"--schema", "{}", "list files"}; !reflect.DeepEqual(args, want) || stdin != "" {
+		t.Fatalf("fresh args = %q (stdin %q), want %q", args, stdin, want)
+	}
+
+	req.yolo = true
+	args, _ = llm.args(req, "abc123")
+	if want := []string{"--cid", "abc123", "list files"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("resume args = %q, want %q", args, want)
+	}
+	args, _ = llm.args(req, "")
+	if args[0] != "--no-confirm" {
+		t.Fatalf("expected yolo flag first, got %q", args)
+	}
+
+	args, stdin = sgpt.args(req, "")
+	if want := []string{"--no-interaction"}; !reflect.DeepEqual(args, want) || stdin != "list files" {
+		t.Fatalf("stdin provider args = %q (stdin %q)", args, stdin)
+	}
+
+	caps := llm.caps()
+	if !caps.yolo || !caps.schema || !caps.resume {
+		t.Fatalf("unexpected llm caps: %+v", caps)
+	}
+	if sgpt.caps().resume {
+		t.Fatalf("sgpt should not support resume")
+	}
+
+	if got := sessionIDFor(llm, "done\nconversation: 01abcXYZ\n"); got != "01abcXYZ" {
+		t.Fatalf("expected session from pattern, got %q", got)
+	}
+}
+
+func TestConfigLayersAndFlagPrecedence(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	userDir := filepath.Join(home, "insta-assist")
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	userConfig := filepath.Join(userDir, "config.toml")
+	writeFile(t, userConfig, "default_cli = \"claude\"\ntimeout = \"90s\"\nyolo = true\noutput = \"stdout\"\ncontext = true\n")
+
+	project := t.TempDir()
+	projectConfig := filepath.Join(project, projectConfigName)
+	writeFile(t, projectConfig, "default_cli = \"gemini\"\ncli_order = [\"gemini\", \"codex\"]\n")
+	nested := filepath.Join(project, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.defaultCLI != "gemini" || cfg.sources["default_cli"] != projectConfig {
+		t.Fatalf("expected project default_cli, got %q from %q", cfg.defaultCLI, cfg.sources["default_cli"])
+	}
+	if cfg.timeout != 90*time.Second || cfg.sources["timeout"] != userConfig {
+		t.Fatalf("expected user timeout, got %v from %q", cfg.timeout, cfg.sources["timeout"])
+	}
+	if cfg.sources["theme"] != sourceDefault {
+		t.Fatalf("expected default theme source, got %q", cfg.sources["theme"])
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := registerFlags(fs)
+	if err := fs.Parse([]string{"-cli", "codex", "-yolo=false", "-no-context"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.applyFlags(fs, f); err != nil {
+		t.Fatalf("applyFlags returned error: %v", err)
+	}
+	if cfg.defaultCLI != "codex" || cfg.sources["default_cli"] != "flag -cli" {
+		t.Fatalf("expected flag to win, got %q from %q", cfg.defaultCLI, cfg.sources["default_cli"])
+	}
+	if cfg.yolo {
+		t.Fatalf("expected -yolo=false to override config")
+	}
+	if cfg.context || cfg.sources["context"] != "flag -no-context" {
+		t.Fatalf("expected -no-context to override config, got %v from %q", cfg.context, cfg.sources["context"])
+	}
+	if cfg.output != "stdout" {
+		t.Fatalf("unset flag should not override config output, got %q", cfg.output)
+	}
+
+	names := providerNames(configuredProviders(cfg))
+	if names[0] != "gemini" || names[1] != "codex" {
+		t.Fatalf("expected cli_order to lead, got %v", names)
+	}
+
+	var out bytes.Buffer
+	writeConfig(&out, cfg, names)
+	if !strings.Contains(out.String(), "# flag -cli") || !strings.Contains(out.String(), "# "+userConfig) {
+		t.Fatalf("expected sources in config show output, got:\n%s", out.String())
+	}
+}
+
+func TestProjectConfigCannotDefineProviders(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	project := t.TempDir()
+	writeFile(t, filepath.Join(project, projectConfigName), "[[providers]]\nname = \"x\"\ncommand = \"x\"\n")
+	t.Chdir(project)
+
+	if _, err := loadConfig(); err == nil {
+		t.Fatalf("expected error for providers in project config")
+	}
+}
+
+func TestProjectConfigCannotEnableExecution(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	project := t.TempDir()
+	t.Chdir(project)
+	for _, data := range []string{"yolo = true\n", "stay_open_exec = true\n", "output = \"exec\"\n", "output = \"EXEC\"\n"} {
+		writeFile(t, filepath.Join(project, projectConfigName), data)
+		if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "user config") {
+			t.Errorf("expected %q to be rejected in the project config, got %v", data, err)
+		}
+	}
+
+	writeFile(t, filepath.Join(project, projectConfigName), "yolo = false\noutput = \"stdout\"\n")
+	if cfg, err := loadConfig(); err != nil || cfg.output != "stdout" {
+		t.Errorf("expected safe project settings to load, got %q, %v", cfg.output, err)
+	}
+}
+
+func TestParseConfigRejectsUnknownKeys(t *testing.T) {
+	for data, want := range map[string]string{
+		"timout = \"30s\"\n":                            `unknown key "timout"`,
+		"[key]\nsend = \"ctrl+s\"\n":                    `unknown key "key"`,
+		"[themes.neon]\nacent = \"1\"\n":                `unknown key "themes.neon.acent"`,
+		"[[providers]]\nname = \"x\"\ncomand = \"x\"\n": `unknown key "providers.comand"`,
+	} {
+		var layer fileConfig
+		if err := parseConfig(data, &layer); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseConfig(%q) = %v, want %s", data, err, want)
+		}
+	}
+
+	var layer fileConfig
+	if err := parseConfig("timeout = \"30s\"\n[keys]\nsend = \"ctrl+s\"\n", &layer); err != nil {
+		t.Errorf("expected known keys to parse, got %v", err)
+	}
+}
+
+func TestConfigRejectsInvalidValues(t *testing.T) {
+	for _, data := range []string{"timeout = \"soon\"", "output = \"printer\"", "theme = \"neon\"", "cache_ttl = \"-1h\"", "cache_max_entries = 0"} {
+		var layer fileConfig
+		if err := parseConfig(data, &layer); err != nil {
+			t.Fatalf("parseConfig(%q) returned error: %v", data, err)
+		}
+		cfg := defaultConfig()
+		if err := cfg.merge(layer, "test"); err == nil {
+			t.Fatalf("expected merge error for %q", data)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
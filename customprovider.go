@@ -0,0 +1,134 @@
+package instassist
+
+import (
+	"regexp"
+	"strings"
+)
+
+// customProviderConfig declares an extra CLI provider in config.toml:
+//
+//	[[providers]]
+//	name = "llm"
+//	command = "llm"
+//	args = ["--schema", "{schema_json}", "{prompt}"]
+//	resume_args = ["--cid", "{session_id}", "--schema", "{schema_json}", "{prompt}"]
+//	prompt_input = "argv"
+//	session_pattern = "conversation: (\\S+)"
+//
+// Args may use the placeholders {prompt}, {schema_path}, {schema_json},
+// {session_id} and {yolo}. An argument that is exactly {yolo} expands to
+// yolo_flag when YOLO is on and is dropped otherwise.
+type customProviderConfig struct {
+	Name           string   `toml:"name"`
+	Command        string   `toml:"command"`
+	Args           []string `toml:"args"`
+	ResumeArgs     []string `toml:"resume_args"`
+	PromptInput    string   `toml:"prompt_input"` // "argv" (default) or "stdin"
+	YoloFlag       string   `toml:"yolo_flag"`
+	SessionPattern string   `toml:"session_pattern"` // regex; first group (or whole match) is the session ID
+}
+
+// customProvider is a cliProvider built from a config entry, with an
+// optional provider-specific way of finding its session ID.
+type customProvider struct {
+	cliProvider
+	sessionPattern *regexp.Regexp
+}
+
+// sessionFinder is implemented by providers that know how to locate the
+// session ID in their own output.
+type sessionFinder interface {
+	findSession(raw string) string
+}
+
+func (p customProvider) findSession(raw string) string {
+	if p.sessionPattern == nil {
+		return extractSessionID(raw)
+	}
+	groups := p.sessionPattern.FindStringSubmatch(raw)
+	switch {
+	case len(groups) > 1:
+		return groups[1]
+	case len(groups) == 1:
+		return groups[0]
+	}
+	return ""
+}
+
+// sessionIDFor extracts the session ID from a provider's output.
+func sessionIDFor(p provider, raw string) string {
+	if f, ok := p.(sessionFinder); ok {
+		return f.findSession(raw)
+	}
+	return extractSessionID(raw)
+}
+
+func newCustomProvider(pc customProviderConfig) customProvider {
+	usesSchema := false
+	for _, placeholder := range []string{"{schema_path}", "{schema_json}"} {
+		if argsMention(pc.Args, placeholder) || argsMention(pc.ResumeArgs, placeholder) {
+			usesSchema = true
+		}
+	}
+
+	var pattern *regexp.Regexp
+	if pc.SessionPattern != "" {
+		pattern, _ = regexp.Compile(pc.SessionPattern)
+	}
+
+	return customProvider{
+		cliProvider: cliProvider{
+			id:     pc.Name,
+			binary: pc.Command,
+			features: providerCaps{
+				yolo:   pc.YoloFlag != "",
+				schema: usesSchema,
+				resume: len(pc.ResumeArgs) > 0,
+			},
+			args: func(req providerRequest, sessionID string) ([]string, string) {
+				tmpl := pc.Args
+				if sessionID != "" && len(pc.ResumeArgs) > 0 {
+					tmpl = pc.ResumeArgs
+				}
+				args := expandArgs(tmpl, pc, req, sessionID)
+				if pc.PromptInput == "stdin" {
+					return args, req.prompt
+				}
+				if !argsMention(tmpl, "{prompt}") {
+					args = append(args, req.prompt)
+				}
+				return args, ""
+			},
+		},
+		sessionPattern: pattern,
+	}
+}
+
+func expandArgs(tmpl []string, pc customProviderConfig, req providerRequest, sessionID string) []string {
+	replacer := strings.NewReplacer(
+		"{prompt}", req.prompt,
+		"{schema_path}", req.schema.path,
+		"{schema_json}", req.schema.json,
+		"{session_id}", sessionID,
+	)
+	args := make([]string, 0, len(tmpl))
+	for _, a := range tmpl {
+		if a == "{yolo}" {
+			if req.yolo && pc.YoloFlag != "" {
+				args = append(args, pc.YoloFlag)
+			}
+			continue
+		}
+		args = append(args, replacer.Replace(a))
+	}
+	return args
+}
+
+func argsMention(args []string, placeholder string) bool {
+	for _, a := range args {
+		if strings.Contains(a, placeholder) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package instassist
+
+import (
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// hasBinary reports whether name is in PATH, caching the lookup so the
+// detail pane does not walk PATH on every render.
+func (m model) hasBinary(name string) bool {
+	if found, ok := m.binaries[name]; ok {
+		return found
+	}
+	found := cliAvailable(name)
+	if m.binaries != nil {
+		m.binaries[name] = found
+	}
+	return found
+}
+
+// missingRequirements returns the binaries an option requires that are not
+// in PATH.
+func missingRequirements(opt optionEntry, has func(string) bool) []string {
+	var missing []string
+	for _, name := range opt.Requires {
+		if !has(name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// platformMatches reports whether an option's declared platform covers the
+// running OS. Unknown or generic platforms match. Names are compared as
+// whole words, so "win" does not match "darwin".
+func platformMatches(platform, goos string) bool {
+	words := strings.FieldsFunc(strings.ToLower(platform), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) == 0 {
+		return true
+	}
+	aliases := map[string][]string{
+		"linux":   {"linux", "unix", "posix", "any", "all"},
+		"darwin":  {"macos", "mac", "osx", "darwin", "unix", "posix", "bsd", "any", "all"},
+		"windows": {"windows", "win", "powershell", "any", "all"},
+		"freebsd": {"freebsd", "bsd", "unix", "posix", "any", "all"},
+	}
+	names, ok := aliases[goos]
+	if !ok {
+		return true
+	}
+	for _, word := range words {
+		if slices.Contains(names, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderOptionDetail shows the selected option's explanation, requirements,
+// platform, mode fields and risk reasons. It renders nothing when the model
+// gave none.
+func (m model) renderOptionDetail() string {
+	opt, ok := m.selectedOption()
+	if !ok {
+		return ""
+	}
+	risk := m.optionRisk(opt)
+	if opt.Explanation == "" && len(opt.Requires) == 0 && opt.Platform == "" && len(opt.Fields) == 0 && risk.level == riskSafe {
+		return ""
+	}
+
+	labelStyle := m.theme.fg(m.theme.info).Bold(true)
+	textStyle := m.theme.fg(m.theme.muted)
+	warnStyle := m.theme.fg(m.theme.warning).Bold(true)
+
+	var b strings.Builder
+	if opt.Explanation != "" {
+		b.WriteString(labelStyle.Render("Explanation:"))
+		b.WriteString("\n")
+		for _, line := range strings.Split(opt.Explanation, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				b.WriteString(textStyle.Render("  " + line))
+				b.WriteString("\n")
+			}
+		}
+	}
+	if len(opt.Requires) > 0 {
+		b.WriteString(labelStyle.Render("Requires: "))
+		b.WriteString(textStyle.Render(strings.Join(opt.Requires, ", ")))
+		b.WriteString("\n")
+		if missing := missingRequirements(opt, m.hasBinary); len(missing) > 0 {
+			b.WriteString(warnStyle.Render(m.theme.glyphs.warn + " not found in PATH: " + strings.Join(missing, ", ")))
+			b.WriteString("\n")
+		}
+	}
+	if opt.Platform != "" {
+		b.WriteString(labelStyle.Render("Platform: "))
+		b.WriteString(textStyle.Render(opt.Platform))
+		b.WriteString("\n")
+		if !platformMatches(opt.Platform, runtime.GOOS) {
+			b.WriteString(warnStyle.Render(m.theme.glyphs.warn + " written for " + opt.Platform + ", this is " + runtime.GOOS))
+			b.WriteString("\n")
+		}
+	}
+	if len(opt.Fields) > 0 {
+		names := make([]string, 0, len(opt.Fields))
+		for name := range opt.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			label := strings.ReplaceAll(name, "_", " ")
+			b.WriteString(labelStyle.Render(strings.ToUpper(label[:1]) + label[1:] + ": "))
+			b.WriteString(textStyle.Render(opt.Fields[name]))
+			b.WriteString("\n")
+		}
+	}
+	if risk.level != riskSafe {
+		b.WriteString(labelStyle.Render("Risk: "))
+		b.WriteString(m.theme.riskStyle(risk.level).Render(risk.level.String()))
+		b.WriteString("\n")
+		for _, reason := range risk.reasons {
+			b.WriteString(textStyle.Render("  " + m.theme.glyphs.item + " " + reason))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package instassist
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// editorFinishedMsg carries the command text back from $EDITOR.
+type editorFinishedMsg struct {
+	value string
+	err   error
+}
+
+// openEdit loads value into an editable textarea for the option being edited.
+func (m model) openEdit(opt optionEntry, value string) (tea.Model, tea.Cmd) {
+	input := textarea.New()
+	input.Prompt = ""
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	m.theme.style(&input)
+	if m.width > 10 {
+		input.SetWidth(m.width - 10)
+	}
+	input.SetHeight(min(strings.Count(value, "\n")+1, 10))
+	input.SetValue(value)
+	input.Focus()
+
+	m.editSource = opt
+	m.editInput = input
+	m.mode = modeEdit
+	m.running = false
+	m.status = m.helpEdit()
+	return m, textarea.Blink
+}
+
+// openEditor writes value to a temp file and suspends the TUI to edit it in
+// $VISUAL or $EDITOR (vi if neither is set).
+func openEditor(value string) tea.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := os.CreateTemp("", "insta-assist-*.sh")
+	if err != nil {
+		return func() tea.Msg { return editorFinishedMsg{err: err} }
+	}
+	path := f.Name()
+	_, err = f.WriteString(value + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return func() tea.Msg { return editorFinishedMsg{err: err} }
+	}
+
+	// $EDITOR may carry arguments, e.g. "code -w".
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return editorFinishedMsg{err: fmt.Errorf("%s: %w", fields[0], err)}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return editorFinishedMsg{err: err}
+		}
+		return editorFinishedMsg{value: strings.TrimRight(string(data), "\n")}
+	})
+}
+
+func (m model) handleEditorFinished(msg editorFinishedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.mode = modeViewing
+		m.status = fmt.Sprintf("%s editor failed: %v • %s", m.theme.glyphs.fail, msg.err, m.helpViewing())
+		return m, nil
+	}
+	if strings.TrimSpace(msg.value) == "" {
+		m.mode = modeViewing
+		m.status = "empty command, edit discarded • " + m.helpViewing()
+		return m, nil
+	}
+	return m.openEdit(m.editSource, msg.value)
+}
+
+func (m model) handleEditKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc":
+		m.mode = modeViewing
+		m.status = m.helpViewing()
+		return m, nil
+	case editKey(msg, m.keys.Newline):
+		m.editInput.InsertString("\n")
+		m.editInput.SetHeight(min(strings.Count(m.editInput.Value(), "\n")+1, 10))
+		return m, nil
+	case editKey(msg, m.keys.Run) || msg.Type == tea.KeyEnter:
+		value := strings.TrimSpace(m.editInput.Value())
+		if value == "" {
+			m.status = "nothing to use • " + m.helpEdit()
+			return m, nil
+		}
+		opt := m.editSource
+		opt.Value = value
+		if value != strings.TrimSpace(m.editSource.Value) {
+			m.editedFrom = m.editSource.Value
+		}
+		m.mode = modeViewing
+		m.status = m.helpViewing()
+		action := actionCopied
+		if editKey(msg, m.keys.Run) {
+			action = actionExecuted
+		}
+		return m.useOption(opt, action)
+	}
+
+	var cmd tea.Cmd
+	m.editInput, cmd = m.editInput.Update(msg)
+	return m, cmd
+}
+
+// editKey matches b in the editor, where printable keys are typed into
+// the command instead.
+func editKey(msg tea.KeyMsg, b key.Binding) bool {
+	return (msg.Type != tea.KeyRunes || msg.Alt) && key.Matches(msg, b)
+}
+
+func (m model) renderEdit() string {
+	labelStyle := m.theme.fg(m.theme.info).Bold(true)
+	boxStyle := lipgloss.NewStyle().
+		Border(m.theme.glyphs.border).
+		BorderForeground(m.theme.border).
+		Padding(0, 1)
+
+	var b strings.Builder
+	b.WriteString(labelStyle.Render("Edit command:"))
+	b.WriteString("\n")
+	b.WriteString(boxStyle.Render(m.editInput.View()))
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package instassist
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const helpPreview = "esc/ctrl+o: back to prompt"
+
+// contextTools are the binaries worth telling the model about: they change
+// which command is the best answer.
+var contextTools = []string{
+	"rg", "fd", "fzf", "jq", "yq", "bat", "eza", "git", "gh",
+	"docker", "podman", "kubectl", "helm", "terraform",
+	"python3", "node", "go", "brew", "apt", "dnf", "pacman",
+}
+
+// envInfo describes the machine the suggested commands will run on.
+type envInfo struct {
+	os        string
+	distro    string
+	shell     string
+	cwd       string
+	gitRepo   bool
+	gitBranch string
+	tools     []string
+}
+
+// gatherEnv collects the environment context. Every probe is local and
+// best-effort; anything that cannot be determined is left empty.
+func gatherEnv() envInfo {
+	env := envInfo{os: runtime.GOOS}
+	switch runtime.GOOS {
+	case "linux":
+		env.distro = osReleaseName("/etc/os-release")
+	case "darwin":
+		env.os = "macOS"
+		env.distro = macOSVersion()
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		env.shell = filepath.Base(sh)
+	}
+	env.cwd, _ = os.Getwd()
+	if env.cwd != "" {
+		env.gitRepo, env.gitBranch = gitInfo(env.cwd)
+	}
+	for _, tool := range contextTools {
+		if cliAvailable(tool) {
+			env.tools = append(env.tools, tool)
+		}
+	}
+	return env
+}
+
+// osReleaseName returns PRETTY_NAME (or NAME) from an os-release file.
+func osReleaseName(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			values[key] = strings.Trim(value, `"'`)
+		}
+	}
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+	return values["NAME"]
+}
+
+func macOSVersion() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sw_vers", "-productVersion").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitInfo reports whether dir is inside a git work tree and its current
+// branch, by reading .git/HEAD rather than running git.
+func gitInfo(dir string) (bool, string) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !fi.IsDir() {
+				// Worktrees and submodules use a "gitdir: <path>" file.
+				data, err := os.ReadFile(dotGit)
+				if err != nil {
+					return true, ""
+				}
+				gitDir = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return true, ""
+			}
+			ref := strings.TrimSpace(string(head))
+			if branch, ok := strings.CutPrefix(ref, "ref: refs/heads/"); ok {
+				return true, branch
+			}
+			return true, "(detached HEAD)"
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, ""
+		}
+		dir = parent
+	}
+}
+
+// block renders the context as the paragraph added to the prompt.
+func (e envInfo) block() string {
+	var b strings.Builder
+	b.WriteString("Environment (tailor commands to it):\n")
+	osLine := e.os
+	if e.distro != "" {
+		osLine += " (" + e.distro + ")"
+	}
+	b.WriteString("- OS: " + osLine + "\n")
+	if e.shell != "" {
+		b.WriteString("- Shell: " + e.shell + "\n")
+	}
+	if e.cwd != "" {
+		b.WriteString("- Working directory: " + e.cwd + "\n")
+	}
+	switch {
+	case e.gitRepo && e.gitBranch != "":
+		b.WriteString("- Git: inside a repository, branch " + e.gitBranch + "\n")
+	case e.gitRepo:
+		b.WriteString("- Git: inside a repository\n")
+	default:
+		b.WriteString("- Git: not a repository\n")
+	}
+	if len(e.tools) > 0 {
+		b.WriteString("- Installed tools: " + strings.Join(e.tools, ", ") + "\n")
+	}
+	return b.String()
+}
+
+// contextBlock returns the environment block for new prompts, or "" when
+// context is off.
+func (m model) contextBlock() string {
+	if !m.useContext {
+		return ""
+	}
+	return m.env.block()
+}
+
+// promptFor builds the exact prompt submitPrompt sends for content. Refine
+// turns go to an existing session, which already has the context.
+func (m model) promptFor(content string, refine bool) string {
+	if refine {
+		return buildPrompt(m.preamble(), "", content, m.modeFields()...)
+	}
+	return buildPrompt(m.preamble(), m.contextBlock(), content, m.modeFields()...)
+}
+
+func (m *model) toggleContext() {
+	m.useContext = !m.useContext
+}
+
+func (m model) openPreview() (tea.Model, tea.Cmd) {
+	content := strings.TrimRight(m.input.Value(), "\n")
+	m.preview = m.promptFor(content, m.mode == modeRefine)
+	m.previewReturn = m.mode
+	m.mode = modePreview
+	m.status = helpPreview
+	return m, nil
+}
+
+func (m model) handlePreviewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc" || msg.Type == tea.KeyCtrlO || msg.Type == tea.KeyEnter || msg.String() == "q":
+		m.mode = m.previewReturn
+		m.status = m.helpInput()
+		if m.mode == modeRefine {
+			m.status = m.helpRefine()
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m model) renderPreview() string {
+	titleStyle := m.theme.fg(m.theme.accent).Bold(true)
+	textStyle := m.theme.fg(m.theme.text)
+	width := m.width - 4
+	if width < 20 {
+		width = 20
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Prompt preview (" + m.currentCLI().name() + ")"))
+	b.WriteString("\n")
+	for _, line := range strings.Split(m.preview, "\n") {
+		if line == "" {
+			b.WriteString("\n")
+			continue
+		}
+		for _, wrapped := range wrapWithStarts(line, width).lines {
+			b.WriteString(textStyle.Render(wrapped))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
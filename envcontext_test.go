@@ -0,0 +1,45 @@
+package instassist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitInfo(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/feature/ctx\n")
+	nested := filepath.Join(repo, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if ok, branch := gitInfo(nested); !ok || branch != "feature/ctx" {
+		t.Fatalf("gitInfo = %v, %q", ok, branch)
+	}
+
+	// Worktrees point at their git dir through a .git file.
+	worktree := t.TempDir()
+	gitDir := filepath.Join(t.TempDir(), "wt")
+	if err := os.MkdirAll(gitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "0123456789abcdef\n")
+	writeFile(t, filepath.Join(worktree, ".git"), "gitdir: "+gitDir+"\n")
+	if ok, branch := gitInfo(worktree); !ok || branch != "(detached HEAD)" {
+		t.Fatalf("gitInfo worktree = %v, %q", ok, branch)
+	}
+}
+
+func TestOSReleaseName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	writeFile(t, path, "NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 24.04 LTS\"\nID=ubuntu\n")
+	if got := osReleaseName(path); got != "Ubuntu 24.04 LTS" {
+		t.Fatalf("osReleaseName = %q", got)
+	}
+	if got := osReleaseName(filepath.Join(t.TempDir(), "missing")); got != "" {
+		t.Fatalf("expected empty name for missing file, got %q", got)
+	}
+}
@@ -0,0 +1,457 @@
+package instassist
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	helpExplain        = "up/down/pgup/pgdn: scroll • esc/x: back to options • ctrl+c: quit"
+	helpExplainRunning = "esc: back to options • ctrl+c: quit"
+)
+
+// explainPart is one token of an explained command: the program, a flag
+// with its value, or an argument.
+type explainPart struct {
+	Token       string `json:"token"`
+	Explanation string `json:"explanation"`
+}
+
+// explanation is the provider's breakdown of a command, shaped by
+// explain.schema.json. Risk and RiskReasons combine the provider's verdict
+// with the local risk analyzer.
+type explanation struct {
+	Command     string        `json:"command"`
+	Summary     string        `json:"summary"`
+	Parts       []explainPart `json:"parts"`
+	SideEffects []string      `json:"side_effects,omitempty"`
+	Risk        string        `json:"risk,omitempty"`
+	RiskReasons []string      `json:"risk_reasons,omitempty"`
+}
+
+// UnmarshalJSON decodes an explanation as leniently as optionEntry does.
+func (e *explanation) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	e.Command = lenientString(raw["command"], " ")
+	e.Summary = lenientString(raw["summary"], " ")
+	// Side effects are sentences, so a single string is kept whole rather
+	// than split like lenientList does.
+	var effects []string
+	if json.Unmarshal(raw["side_effects"], &effects) != nil {
+		effects = []string{lenientString(raw["side_effects"], " ")}
+	}
+	for _, effect := range effects {
+		if effect = strings.TrimSpace(effect); effect != "" {
+			e.SideEffects = append(e.SideEffects, effect)
+		}
+	}
+	e.Risk = normalizeRisk(lenientString(raw["risk"], " "))
+	e.RiskReasons = lenientList(raw["risk_reasons"])
+
+	var parts []map[string]json.RawMessage
+	if json.Unmarshal(raw["parts"], &parts) == nil {
+		for _, part := range parts {
+			token := lenientString(part["token"], " ")
+			if token == "" {
+				continue
+			}
+			e.Parts = append(e.Parts, explainPart{Token: token, Explanation: lenientString(part["explanation"], " ")})
+		}
+	}
+	return nil
+}
+
+// buildExplainPrompt asks for a breakdown of command in the shape of
+// explain.schema.json.
+func buildExplainPrompt(envBlock, command string) string {
+	if envBlock != "" && !strings.HasSuffix(envBlock, "\n") {
+		envBlock += "\n"
+	}
+	return "Explain the following shell command for someone about to run it. Do not run it. " +
+		"Split it into its tokens in order (the program, each flag together with its value, each argument, each pipe or redirection) and explain each token in a short phrase. " +
+		"Then list its side effects (files written or deleted, network access, processes started, privileges needed) and rate its risk.\n" +
+		"Command: " + command + "\n" + envBlock +
+		`Respond ONLY with JSON shaped like {"summary":"...","parts":[{"token":"...","explanation":"..."}],"side_effects":["..."],"risk":"safe"}. "risk" is "safe", "caution" or "destructive"; use null when unknown. No extra text.`
+}
+
+// extractExplanation finds the explanation in a provider's output, whether
+// it is plain JSON, wrapped in the provider's JSONL events or surrounded by
+// prose. The last explanation found wins.
+func extractExplanation(raw string) (explanation, error) {
+	var found explanation
+	ok := false
+	try := func(v any) {
+		if e, k := findExplanationInValue(v); k {
+			found, ok = e, true
+		}
+	}
+
+	var whole any
+	if json.Unmarshal([]byte(strings.TrimSpace(raw)), &whole) == nil {
+		try(whole)
+	}
+	if !ok {
+		scanner := bufio.NewScanner(strings.NewReader(raw))
+		scanner.Buffer(make([]byte, 0, 2*1024*1024), 2*1024*1024)
+		for scanner.Scan() {
+			var v any
+			if json.Unmarshal([]byte(strings.TrimSpace(scanner.Text())), &v) == nil {
+				try(v)
+			}
+		}
+	}
+	if !ok {
+		try(raw)
+	}
+	if !ok {
+		return explanation{}, fmt.Errorf("failed to parse explanation JSON")
+	}
+	return found, nil
+}
+
+func findExplanationInValue(v any) (explanation, bool) {
+	switch val := v.(type) {
+	case map[string]any:
+		if _, ok := val["parts"]; ok {
+			var e explanation
+			if b, err := json.Marshal(val); err == nil && json.Unmarshal(b, &e) == nil && len(e.Parts) > 0 {
+				return e, true
+			}
+		}
+		for _, nested := range val {
+			if e, ok := findExplanationInValue(nested); ok {
+				return e, true
+			}
+		}
+	case []any:
+		for i := len(val) - 1; i >= 0; i-- {
+			if e, ok := findExplanationInValue(val[i]); ok {
+				return e, true
+			}
+		}
+	case string:
+		// The JSON may come as text, possibly inside a code fence or prose.
+		start, end := strings.Index(val, "{"), strings.LastIndex(val, "}")
+		if start < 0 || end <= start {
+			return explanation{}, false
+		}
+		var nested any
+		if json.Unmarshal([]byte(val[start:end+1]), &nested) == nil {
+			return findExplanationInValue(nested)
+		}
+	}
+	return explanation{}, false
+}
+
+// assess folds the local risk analysis of the command into the provider's
+// verdict.
+func (e explanation) assess() explanation {
+	r := analyzeRisk(e.Command).withDeclared(e.Risk)
+	e.Risk = r.level.String()
+	e.RiskReasons = r.reasons
+	return e
+}
+
+// queryExplanation asks p to explain command, classifying failures by exit
+// code like queryProvider.
+func queryExplanation(ctx context.Context, p provider, schema schemaSpec, envBlock, command string) (explanation, error) {
+	req := providerRequest{prompt: buildExplainPrompt(envBlock, command), schema: schema}
+	output, err := sendPrompt(ctx, p, req, "")
+	if err != nil {
+		return explanation{}, &runError{exitProviderError, fmt.Errorf("CLI error: %v\nOutput: %s", err, output)}
+	}
+	exp, err := extractExplanation(string(output))
+	if err != nil {
+		return explanation{}, &runError{exitParseError, fmt.Errorf("parse error: %v\nRaw output: %s", err, output)}
+	}
+	exp.Command = command
+	return exp.assess(), nil
+}
+
+// explainRow is one line of an explanation's token table: the token column,
+// blank on continuation lines, and the text next to it.
+type explainRow struct {
+	token string
+	text  string
+}
+
+// explainRows lays the parts out in two columns, padding every token to the
+// same width so the explanations line up. Tokens wider than a third of the
+// width get a line of their own, with their explanation on the next.
+func explainRows(parts []explainPart, width int) []explainRow {
+	tokenWidth := 0
+	limit := max(width/3, 8)
+	for _, p := range parts {
+		if w := runewidth.StringWidth(p.Token); w <= limit {
+			tokenWidth = max(tokenWidth, w)
+		}
+	}
+	textWidth := max(width-tokenWidth-2, 10)
+	blank := strings.Repeat(" ", tokenWidth)
+
+	var rows []explainRow
+	for _, p := range parts {
+		token := runewidth.FillRight(p.Token, tokenWidth)
+		if runewidth.StringWidth(p.Token) > tokenWidth {
+			rows = append(rows, explainRow{token: p.Token})
+			token = blank
+		}
+		lines := wrapTextLines(p.Explanation, textWidth)
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		for _, line := range lines {
+			rows = append(rows, explainRow{token: token, text: line})
+			token = blank
+		}
+	}
+	return rows
+}
+
+// renderExplanation draws an explanation for the TUI and for `inst
+// explain`; lipgloss drops the colors when the output is not a terminal.
+func renderExplanation(exp explanation, width int, t uiTheme) string {
+	commandStyle := t.fg(t.text).Bold(true)
+	labelStyle := t.fg(t.info).Bold(true)
+	tokenStyle := t.fg(t.accent).Bold(true)
+	textStyle := t.fg(t.muted)
+
+	var b strings.Builder
+	b.WriteString(commandStyle.Render("$ " + cleanText(exp.Command)))
+	b.WriteString("\n")
+	for _, line := range wrapTextLines(exp.Summary, width) {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	for _, row := range explainRows(exp.Parts, width) {
+		b.WriteString(tokenStyle.Render(row.token))
+		if row.text != "" {
+			b.WriteString("  ")
+			b.WriteString(textStyle.Render(row.text))
+		}
+		b.WriteString("\n")
+	}
+	if len(exp.SideEffects) > 0 {
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render("Side effects:"))
+		b.WriteString("\n")
+		for _, effect := range exp.SideEffects {
+			b.WriteString(textStyle.Render("  " + t.glyphs.item + " " + effect))
+			b.WriteString("\n")
+		}
+	}
+	if exp.Risk != "" {
+		level := riskSafe
+		switch exp.Risk {
+		case "caution":
+			level = riskCaution
+		case "destructive":
+			level = riskDestructive
+		}
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render("Risk: "))
+		if level == riskSafe {
+			b.WriteString(textStyle.Render(exp.Risk))
+		} else {
+			b.WriteString(t.riskStyle(level).Render(exp.Risk))
+		}
+		b.WriteString("\n")
+		for _, reason := range exp.RiskReasons {
+			b.WriteString(textStyle.Render("  " + t.glyphs.item + " " + reason))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// runExplainCommand implements `inst explain [flags] <command>`. The command
+// may also be piped on stdin.
+func runExplainCommand(args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("inst explain", flag.ExitOnError)
+	f := registerFlags(fs)
+	fs.Parse(args)
+	if err := cfg.applyFlags(fs, f); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	command := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if command == "" {
+		if stat, _ := os.Stdin.Stat(); stat.Mode()&os.ModeCharDevice == 0 {
+			data, _ := io.ReadAll(os.Stdin)
+			command = strings.TrimSpace(string(data))
+		}
+	}
+	if command == "" {
+		fmt.Fprintln(os.Stderr, "usage: inst explain [flags] <command>")
+		os.Exit(2)
+	}
+
+	jsonOutput := cfg.output == "json" || cfg.output == "jsonl"
+	providers := configuredProviders(cfg)
+	p, ok := lookupProvider(providers, cfg.defaultCLI)
+	if !ok {
+		exitWithError(&runError{exitCLIMissing, fmt.Errorf("unknown CLI: %s (supported: %s)", cfg.defaultCLI, strings.Join(providerNames(providers), ", "))}, jsonOutput)
+	}
+	if !p.available() {
+		exitWithError(&runError{exitCLIMissing, fmt.Errorf("provider not available: %s (CLI not in PATH or API not configured)", p.name())}, jsonOutput)
+	}
+	schemaPath, schemaJSON, err := explainSchemaSources()
+	if err != nil {
+		exitWithError(fmt.Errorf("schema not found: %v", err), jsonOutput)
+	}
+	envBlock := ""
+	if cfg.context {
+		envBlock = gatherEnv().block()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	exp, err := queryExplanation(ctx, p, schemaSpec{path: schemaPath, json: schemaJSON}, envBlock, command)
+	if err != nil {
+		exitWithError(err, jsonOutput)
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		if cfg.output == "json" {
+			enc.SetIndent("", "  ")
+		}
+		enc.Encode(exp)
+		return
+	}
+	width := 80
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+		width = n
+	}
+	fmt.Print(renderExplanation(exp, width, cfg.resolveTheme()))
+}
+
+// explainResultMsg answers the explain request for command.
+type explainResultMsg struct {
+	id      int
+	command string
+	exp     explanation
+	err     error
+}
+
+// openExplain shows the explanation of value, asking the current provider
+// for it unless it was explained before.
+func (m model) openExplain(value string) (tea.Model, tea.Cmd) {
+	width, height := m.execViewportSize()
+	m.explainView = viewport.New(width, height)
+	m.explainCommand = value
+	m.explainErr = nil
+	m.mode = modeExplain
+	if _, ok := m.explanations[value]; ok {
+		m.explainView.SetContent(m.explainContent())
+		m.status = helpExplain
+		return m, nil
+	}
+
+	schemaPath, schemaJSON, err := explainSchemaSources()
+	if err != nil {
+		m.explainErr = err
+		m.explainView.SetContent(m.explainContent())
+		m.status = helpExplain
+		return m, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.timeout)
+	m.requestID++
+	m.cancelRequest = cancel
+	m.running = true
+	m.spinnerFrame = 0
+	m.status = helpExplainRunning
+
+	id := m.requestID
+	p := m.currentCLI()
+	schema := schemaSpec{path: schemaPath, json: schemaJSON}
+	envBlock := m.contextBlock()
+	cmd := func() tea.Msg {
+		defer cancel()
+		exp, err := queryExplanation(ctx, p, schema, envBlock, value)
+		return explainResultMsg{id: id, command: value, exp: exp, err: err}
+	}
+	return m, tea.Batch(cmd, tickCmd)
+}
+
+func (m model) handleExplainResult(msg explainResultMsg) (tea.Model, tea.Cmd) {
+	if msg.id != m.requestID {
+		return m, nil
+	}
+	m.cancelRequest = nil
+	m.running = false
+	if msg.err != nil {
+		m.explainErr = msg.err
+	} else {
+		m.explanations[msg.command] = msg.exp
+	}
+	m.explainView.SetContent(m.explainContent())
+	m.status = helpExplain
+	return m, nil
+}
+
+func (m model) explainContent() string {
+	if m.explainErr != nil {
+		errorStyle := m.theme.fg(m.theme.failure).Bold(true)
+		return errorStyle.Render(fmt.Sprintf("%s Could not explain %s: %v", m.theme.glyphs.fail, cleanText(m.explainCommand), m.explainErr))
+	}
+	return renderExplanation(m.explanations[m.explainCommand], m.explainView.Width, m.theme)
+}
+
+func (m model) handleExplainKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.stopRequest()
+		return m, tea.Quit
+	case "esc", "x", "q":
+		if m.running {
+			// stopRequest moves requestID on, so the cancelled result
+			// is dropped when it arrives.
+			m.stopRequest()
+			m.running = false
+		}
+		m.mode = modeViewing
+		m.status = m.helpViewing()
+	case "up", "k":
+		m.explainView.LineUp(1)
+	case "down", "j":
+		m.explainView.LineDown(1)
+	case "pgup":
+		m.explainView.HalfPageUp()
+	case "pgdown":
+		m.explainView.HalfPageDown()
+	}
+	return m, nil
+}
+
+func (m model) renderExplain() string {
+	if m.running {
+		spinnerStyle := m.theme.fg(m.theme.success).Bold(true)
+		commandStyle := m.theme.fg(m.theme.text).Bold(true)
+		spinner := m.theme.glyphs.spin(m.spinnerFrame)
+		return spinnerStyle.Render(fmt.Sprintf("%s Explaining with %s...", spinner, m.currentCLI().name())) + "\n" +
+			commandStyle.Render("$ "+cleanText(m.explainCommand)) + "\n"
+	}
+	return m.explainView.View() + "\n"
+}
@@ -0,0 +1,88 @@
+package instassist
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestExtractExplanation(t *testing.T) {
+	plain := `{"summary":"Extract an archive","parts":[{"token":"tar","explanation":"archive tool"},{"token":"-xzvf foo.tgz","explanation":"extract the gzipped foo.tgz verbosely"}],"side_effects":"writes files","risk":"low"}`
+	text, _ := json.Marshal(plain)
+	codex := `{"type":"thread.started","thread_id":"t1"}
+{"type":"item.completed","item":{"type":"agent_message","text":` + string(text) + `}}`
+	prose := "Here you go:\n```json\n" + plain + "\n```"
+
+	for name, raw := range map[string]string{"plain": plain, "codex": codex, "prose": prose} {
+		exp, err := extractExplanation(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if exp.Summary != "Extract an archive" || len(exp.Parts) != 2 || exp.Parts[1].Token != "-xzvf foo.tgz" {
+			t.Fatalf("%s: unexpected explanation %+v", name, exp)
+		}
+		if len(exp.SideEffects) != 1 || exp.SideEffects[0] != "writes files" || exp.Risk != "safe" {
+			t.Fatalf("%s: expected lenient side effects and risk, got %+v", name, exp)
+		}
+	}
+
+	if _, err := extractExplanation(`{"options":[{"value":"ls"}]}`); err == nil {
+		t.Fatalf("expected an error without parts")
+	}
+}
+
+func TestExplainRowsAlignTokens(t *testing.T) {
+	parts := []explainPart{
+		{Token: "tar", Explanation: "archive tool"},
+		{Token: "-C /opt", Explanation: "change to /opt before extracting"},
+		{Token: strings.Repeat("x", 40), Explanation: "a long token"},
+	}
+	rows := explainRows(parts, 40)
+	if len(rows) < 5 {
+		t.Fatalf("expected wrapped rows, got %+v", rows)
+	}
+	if rows[0].token != "tar    " || rows[1].token != "-C /opt" {
+		t.Fatalf("expected tokens padded to the same width, got %q and %q", rows[0].token, rows[1].token)
+	}
+	for _, row := range rows[2 : len(rows)-2] {
+		if row.token != "       " {
+			t.Fatalf("expected continuation rows to keep the column, got %+v", rows)
+		}
+	}
+	if last := rows[len(rows)-2:]; last[0].token != parts[2].Token || last[0].text != "" || last[1].text != "a long token" {
+		t.Fatalf("expected a long token on its own line, got %+v", last)
+	}
+}
+
+func TestCancelledExplanationIsDropped(t *testing.T) {
+	m := model{
+		cfg:          defaultConfig(),
+		keys:         defaultKeyMap(),
+		providers:    []provider{cliProvider{id: "codex"}},
+		explanations: map[string]explanation{},
+		mode:         modeViewing,
+	}
+	next, _ := m.openExplain("tar xf a.tgz")
+	m = next.(model)
+	if !m.running {
+		t.Fatalf("expected an explain request to be running")
+	}
+	id := m.requestID
+
+	next, _ = m.handleExplainKeys(tea.KeyMsg{Type: tea.KeyEsc})
+	m = next.(model)
+	next, _ = m.handleExplainResult(explainResultMsg{id: id, command: "tar xf a.tgz", exp: explanation{Summary: "late"}})
+	m = next.(model)
+	if m.mode != modeViewing || m.explainErr != nil || len(m.explanations) != 0 {
+		t.Errorf("expected the late explanation to be dropped, got mode %v, %v, %v", m.mode, m.explainErr, m.explanations)
+	}
+}
+
+func TestExplanationAssessRaisesRisk(t *testing.T) {
+	exp := explanation{Command: "rm -rf /", Risk: "safe"}.assess()
+	if exp.Risk != "destructive" || len(exp.RiskReasons) == 0 {
+		t.Fatalf("expected the analyzer to flag rm -rf /, got %+v", exp)
+	}
+}
@@ -0,0 +1,282 @@
+package instassist
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// zshMeta marks a metafied byte in zsh history files: the byte that follows
+// is stored XOR 0x20.
+const zshMeta = 0x83
+
+var (
+	zshExtendedPrefix = regexp.MustCompile(`^: \d+:\d+;`)
+	bashTimestamp     = regexp.MustCompile(`^#\d+$`)
+)
+
+// unmetafy decodes the bytes zsh metafies when writing its history file.
+func unmetafy(data []byte) []byte {
+	if bytes.IndexByte(data, zshMeta) < 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == zshMeta && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
+
+// parseZshHistory reads plain and EXTENDED_HISTORY zsh files. Multi-line
+// commands are stored with a backslash before each newline.
+func parseZshHistory(data []byte) []string {
+	var commands []string
+	var current strings.Builder
+	continued := false
+	for _, line := range strings.Split(string(unmetafy(data)), "\n") {
+		if !continued {
+			line = zshExtendedPrefix.ReplaceAllString(line, "")
+		}
+		body, more := strings.CutSuffix(line, `\`)
+		if more && strings.HasSuffix(body, `\`) {
+			// An escaped backslash ends the line, it does not continue it.
+			body, more = line, false
+		}
+		current.WriteString(body)
+		if more {
+			current.WriteString("\n")
+			continued = true
+			continue
+		}
+		continued = false
+		if cmd := strings.TrimSpace(current.String()); cmd != "" {
+			commands = append(commands, cmd)
+		}
+		current.Reset()
+	}
+	return commands
+}
+
+// parseBashHistory reads a bash history file, skipping the #<epoch>
+// timestamp lines written with HISTTIMEFORMAT.
+func parseBashHistory(data []byte) []string {
+	var commands []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || bashTimestamp.MatchString(line) {
+			continue
+		}
+		commands = append(commands, line)
+	}
+	return commands
+}
+
+// parseFishHistory reads the "- cmd:" entries of a fish history file.
+func parseFishHistory(data []byte) []string {
+	unescape := strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+	var commands []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if cmd, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			if cmd = strings.TrimSpace(unescape.Replace(cmd)); cmd != "" {
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return commands
+}
+
+var historyParsers = map[string]func([]byte) []string{
+	"zsh":  parseZshHistory,
+	"bash": parseBashHistory,
+	"fish": parseFishHistory,
+}
+
+// shellHistoryPath returns the history file of shell: $HISTFILE when it is
+// exported, or the shell's default location.
+func shellHistoryPath(shell string) (string, error) {
+	if shell != "fish" {
+		if path := os.Getenv("HISTFILE"); path != "" {
+			return path, nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch shell {
+	case "zsh":
+		return filepath.Join(home, ".zsh_history"), nil
+	case "bash":
+		return filepath.Join(home, ".bash_history"), nil
+	case "fish":
+		dataDir := os.Getenv("XDG_DATA_HOME")
+		if dataDir == "" {
+			dataDir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dataDir, "fish", "fish_history"), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (supported: zsh, bash, fish)", shell)
+}
+
+// isFixInvocation reports whether a history entry is `inst fix` itself,
+// which shells that append history immediately have already written.
+func isFixInvocation(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || fields[1] != "fix" {
+		return false
+	}
+	name := filepath.Base(fields[0])
+	return name == "inst" || name == filepath.Base(os.Args[0])
+}
+
+// lastCommand returns the most recent command in commands that is not a
+// call to `inst fix`.
+func lastCommand(commands []string) (string, bool) {
+	for i := len(commands) - 1; i >= 0; i-- {
+		if !isFixInvocation(commands[i]) {
+			return commands[i], true
+		}
+	}
+	return "", false
+}
+
+// lastShellCommand reads the last command from shell's history file.
+func lastShellCommand(shell string) (string, error) {
+	path, err := shellHistoryPath(shell)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s history: %w", shell, err)
+	}
+	cmd, ok := lastCommand(historyParsers[shell](data))
+	if !ok {
+		return "", fmt.Errorf("no commands in %s", path)
+	}
+	return cmd, nil
+}
+
+// historyNotice tells the user which command was read from the history,
+// since it may not be the one that just failed: bash only writes its history
+// file on exit unless PROMPT_COMMAND runs history -a.
+func historyNotice(shell, command string) string {
+	notice := fmt.Sprintf("fixing the last command in the %s history: %s", shell, command)
+	if shell == "bash" {
+		notice += "\nNot the one that failed? Add history -a to PROMPT_COMMAND, or run: inst fix \"$(fc -ln -1)\""
+	}
+	return notice
+}
+
+// splitFixInput separates piped input into the failed command, on the first
+// line, and its output.
+func splitFixInput(input string) (string, string) {
+	input = strings.TrimSpace(input)
+	command, output, _ := strings.Cut(input, "\n")
+	return strings.TrimSpace(command), strings.TrimSpace(output)
+}
+
+// fixCommandPrompt asks for corrected versions of a command the user ran
+// themselves. The exit code is omitted when unknown (negative).
+func fixCommandPrompt(f failedRun) string {
+	var b strings.Builder
+	b.WriteString("This shell command failed. Suggest corrected versions of it that do what it was meant to do, as close to the original as possible, with the change explained in each description.\n")
+	b.WriteString("Command: " + f.command + "\n")
+	if f.exitCode >= 0 {
+		fmt.Fprintf(&b, "Exit code: %d\n", f.exitCode)
+	}
+	if output := strings.TrimSpace(f.output); output != "" {
+		if len(output) > fixOutputLimit {
+			output = output[len(output)-fixOutputLimit:]
+		}
+		b.WriteString("Output:\n" + output + "\n")
+	} else {
+		b.WriteString("Output: (not captured)\n")
+	}
+	return b.String()
+}
+
+// runFixCommand implements `inst fix [flags] [command]`. The failed command
+// comes from the arguments (with its output piped on stdin), from stdin
+// alone (command on the first line, output after it) or from the last entry
+// of the shell history. The options open in the TUI, or are printed with
+// -output json, jsonl or -select.
+func runFixCommand(args []string) {
+	fs := flag.NewFlagSet("inst fix", flag.ExitOnError)
+	flags := registerFlags(fs)
+	shell := fs.String("shell", "", "shell whose history holds the failed command: zsh, bash or fish (default: from $SHELL); bash needs history -a in PROMPT_COMMAND")
+	fs.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+	if err := cfg.applyFlags(fs, flags); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	var f failedRun
+	f.exitCode = -1
+	piped := false
+	if stat, _ := os.Stdin.Stat(); stat.Mode()&os.ModeCharDevice == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("error reading stdin: %v", err)
+		}
+		piped = true
+		f.output = string(data)
+	}
+	switch {
+	case fs.NArg() > 0:
+		// Trimmed for fc -ln, which indents the command.
+		f.command = strings.TrimSpace(strings.Join(fs.Args(), " "))
+	case piped && strings.TrimSpace(f.output) != "":
+		f.command, f.output = splitFixInput(f.output)
+	default:
+		if *shell == "" {
+			*shell = filepath.Base(os.Getenv("SHELL"))
+		}
+		if f.command, err = lastShellCommand(*shell); err != nil {
+			log.Fatalf("%v\nPass the command as an argument: inst fix '<command>'", err)
+		}
+		fmt.Fprintln(os.Stderr, historyNotice(*shell, f.command))
+	}
+
+	providers := configuredProviders(cfg)
+	if cfg.output == "json" || cfg.output == "jsonl" || flags.selectIndex >= 0 {
+		runNonInteractive(providers, cfg, fixCommandPrompt(f), flags)
+		return
+	}
+
+	m := newModel(providers, cfg)
+	m = m.startFix(f)
+	var opts []tea.ProgramOption
+	if piped {
+		opts = append(opts, tea.WithInputTTY())
+	}
+	runTUI(m, opts...)
+}
+
+// startFix submits the fix request for f as soon as the TUI starts.
+func (m model) startFix(f failedRun) model {
+	m.lastPrompt = "fix: " + cleanText(f.command)
+	m.promptHistory = []string{m.lastPrompt}
+	m.recordHistory("", "")
+	next, cmd := m.requestOptions(fixCommandPrompt(f), true)
+	m = next.(model)
+	m.startup = cmd
+	return m
+}
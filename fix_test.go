@@ -0,0 +1,69 @@
+package instassist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseZshHistory(t *testing.T) {
+	data := []byte(": 1700000000:0;ls -la\n" +
+		": 1700000001:3;for f in *; do\\\n  echo $f\\\ndone\n" +
+		"git psuh\n" +
+		": 1700000002:0;echo caf\x83\xc9\n")
+	want := []string{"ls -la", "for f in *; do\n  echo $f\ndone", "git psuh", "echo caf\xe9"}
+	if got := parseZshHistory(data); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseZshHistory = %q, want %q", got, want)
+	}
+}
+
+func TestParseBashHistory(t *testing.T) {
+	data := []byte("#1700000000\nls -la\n\n#1700000001\ngit psuh origin main\n")
+	want := []string{"ls -la", "git psuh origin main"}
+	if got := parseBashHistory(data); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseBashHistory = %q, want %q", got, want)
+	}
+}
+
+func TestParseFishHistory(t *testing.T) {
+	data := []byte("- cmd: ls -la\n  when: 1700000000\n- cmd: printf 'a\\\\nb'\\necho done\n  when: 1700000001\n  paths:\n    - a\n")
+	want := []string{"ls -la", "printf 'a\\nb'\necho done"}
+	if got := parseFishHistory(data); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseFishHistory = %q, want %q", got, want)
+	}
+}
+
+func TestLastCommandSkipsFixInvocation(t *testing.T) {
+	cmd, ok := lastCommand([]string{"git psuh", "inst fix", "/usr/local/bin/inst fix -cli claude"})
+	if !ok || cmd != "git psuh" {
+		t.Fatalf("lastCommand = %q, %v", cmd, ok)
+	}
+	if _, ok := lastCommand([]string{"inst fix"}); ok {
+		t.Fatalf("expected no command when history only has inst fix")
+	}
+}
+
+func TestHistoryNotice(t *testing.T) {
+	if got := historyNotice("zsh", "git psuh"); got != "fixing the last command in the zsh history: git psuh" {
+		t.Errorf("unexpected notice %q", got)
+	}
+	if got := historyNotice("bash", "git psuh"); !strings.Contains(got, "git psuh") || !strings.Contains(got, "history -a") {
+		t.Errorf("expected the bash notice to explain history -a, got %q", got)
+	}
+}
+
+func TestFixCommandPrompt(t *testing.T) {
+	command, output := splitFixInput("git psuh\ngit: 'psuh' is not a git command.\n")
+	prompt := fixCommandPrompt(failedRun{command: command, exitCode: -1, output: output})
+	for _, want := range []string{"Command: git psuh\n", "Output:\ngit: 'psuh' is not a git command.\n"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("expected prompt to contain %q, got: %s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "Exit code") {
+		t.Fatalf("expected no exit code when it is unknown, got: %s", prompt)
+	}
+	if prompt := fixCommandPrompt(failedRun{command: "make", exitCode: 2}); !strings.Contains(prompt, "Exit code: 2\nOutput: (not captured)") {
+		t.Fatalf("unexpected prompt: %s", prompt)
+	}
+}
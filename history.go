@@ -0,0 +1,410 @@
+package instassist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	historyFileName = "history.jsonl"
+	historyMaxLoad  = 5000
+
+	actionCopied   = "copied"
+	actionExecuted = "executed"
+	actionInserted = "inserted" // written to a shell widget's file descriptor
+
+	helpHistory = "enter: resubmit • tab: re-pick command • up/down: move • esc: close"
+)
+
+// historyEntry is one line of history.jsonl. A submitted prompt is recorded
+// without a choice; copying or running an option records a second entry
+// with the choice and the action taken.
+type historyEntry struct {
+	Time   time.Time `json:"time"`
+	CLI    string    `json:"cli"`
+	Cwd    string    `json:"cwd"`
+	Prompt string    `json:"prompt"`
+	Choice string    `json:"choice,omitempty"`
+	Action string    `json:"action,omitempty"`
+	// Original is the suggested command when Choice was edited before use.
+	Original string `json:"original,omitempty"`
+}
+
+// stateDir returns $XDG_STATE_HOME/insta-assist, falling back to
+// ~/.local/state/insta-assist.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "insta-assist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "insta-assist"), nil
+}
+
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFileName), nil
+}
+
+func appendHistory(entry historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory returns up to historyMaxLoad of the most recent entries,
+// oldest first. Malformed lines are skipped.
+func loadHistory() ([]historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	for scanner.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Prompt == "" {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > historyMaxLoad {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// recentPrompts returns distinct prompts, most recent first.
+func recentPrompts(entries []historyEntry) []string {
+	seen := map[string]bool{}
+	var prompts []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		p := entries[i].Prompt
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		prompts = append(prompts, p)
+	}
+	return prompts
+}
+
+// historyItems returns entries for the search overlay, most recent first,
+// keeping only the latest entry per prompt/choice pair.
+func historyItems(entries []historyEntry) []historyEntry {
+	seen := map[string]bool{}
+	var items []historyEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		key := e.Prompt + "\x00" + e.Choice
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, e)
+	}
+	return items
+}
+
+// fuzzyScore reports whether all runes of query appear in text in order
+// (case-insensitively) and scores the match: consecutive runes and runes at
+// word starts score higher. An empty query matches everything.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.TrimSpace(query)))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(strings.ToLower(text))
+	score := 0
+	qi := 0
+	prev := -2
+	for ti, r := range t {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 3
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 2
+		}
+		prev = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+// filterHistory ranks items by fuzzy score against prompt and choice,
+// keeping recency order between equal scores.
+func filterHistory(items []historyEntry, query string) []historyEntry {
+	type scored struct {
+		entry historyEntry
+		score int
+	}
+	var matches []scored
+	for _, e := range items {
+		if score, ok := fuzzyScore(query, e.Prompt+" "+e.Choice); ok {
+			matches = append(matches, scored{entry: e, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	out := make([]historyEntry, len(matches))
+	for i, s := range matches {
+		out[i] = s.entry
+	}
+	return out
+}
+
+func (m *model) recordHistory(choice, action string) {
+	prompt := strings.Join(m.promptHistory, "\n")
+	if prompt == "" {
+		prompt = m.lastPrompt
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return
+	}
+	cwd, _ := os.Getwd()
+	entry := historyEntry{
+		Time:   time.Now(),
+		CLI:    m.currentCLI().name(),
+		Cwd:    cwd,
+		Prompt: prompt,
+		Choice: choice,
+		Action: action,
+	}
+	if choice != "" && m.editedFrom != "" {
+		entry.Original = m.editedFrom
+		m.editedFrom = ""
+	}
+	// History is best-effort; a read-only state dir must not break the TUI.
+	_ = appendHistory(entry)
+	m.history = append(m.history, entry)
+}
+
+// cycleHistory moves through past prompts like a shell: delta -1 goes to an
+// older prompt, +1 to a newer one, and past the newest restores the draft.
+func (m *model) cycleHistory(delta int) {
+	prompts := recentPrompts(m.history)
+	if len(prompts) == 0 {
+		return
+	}
+	if m.historyIndex < 0 {
+		if delta > 0 {
+			return
+		}
+		m.historyDraft = m.input.Value()
+	}
+	next := m.historyIndex - delta
+	if next >= len(prompts) {
+		next = len(prompts) - 1
+	}
+	m.historyIndex = next
+	if next < 0 {
+		m.historyIndex = -1
+		m.input.SetValue(m.historyDraft)
+	} else {
+		m.input.SetValue(prompts[next])
+	}
+	m.input.CursorEnd()
+	m.adjustTextareaHeight()
+}
+
+func (m model) openHistory() (tea.Model, tea.Cmd) {
+	query := textinput.New()
+	query.Placeholder = "search history"
+	query.Prompt = m.theme.glyphs.search + " "
+	query.Focus()
+	m.historyQuery = query
+	m.historyReturn = m.mode
+	m.historyMatches = historyItems(m.history)
+	m.historySelected = 0
+	m.mode = modeHistory
+	m.status = helpHistory
+	return m, textinput.Blink
+}
+
+func (m model) closeHistory() model {
+	m.mode = m.historyReturn
+	m.status = m.helpInput()
+	if m.mode == modeRefine {
+		m.status = m.helpRefine()
+	}
+	return m
+}
+
+func (m model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc":
+		return m.closeHistory(), nil
+	case msg.String() == "up" || msg.Type == tea.KeyCtrlP:
+		if m.historySelected > 0 {
+			m.historySelected--
+		}
+		return m, nil
+	case msg.String() == "down" || msg.Type == tea.KeyCtrlN:
+		if m.historySelected < len(m.historyMatches)-1 {
+			m.historySelected++
+		}
+		return m, nil
+	case msg.Type == tea.KeyEnter:
+		entry, ok := m.selectedHistory()
+		if !ok {
+			return m, nil
+		}
+		m = m.closeHistory()
+		m.mode = modeInput
+		m.input.SetValue(entry.Prompt)
+		m.autoExecute = false
+		return m.submitPrompt()
+	case msg.Type == tea.KeyTab:
+		entry, ok := m.selectedHistory()
+		if !ok {
+			return m, nil
+		}
+		if entry.Choice == "" {
+			m.status = "no command was chosen for this prompt • " + helpHistory
+			return m, nil
+		}
+		m.mode = modeViewing
+		m.running = false
+		m.promptHistory = []string{entry.Prompt}
+		m.lastPrompt = entry.Prompt
+		m.options = []optionEntry{{Value: entry.Choice, Description: fmt.Sprintf("from history (%s, %s)", entry.CLI, entry.Time.Format("2006-01-02"))}}
+		m.selected = 0
+		m.lastError = nil
+		m.lastParseError = nil
+		m.rawOutput = ""
+		m.execOutput = ""
+		m.status = m.helpViewing()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	before := m.historyQuery.Value()
+	m.historyQuery, cmd = m.historyQuery.Update(msg)
+	if m.historyQuery.Value() != before {
+		m.historyMatches = filterHistory(historyItems(m.history), m.historyQuery.Value())
+		m.historySelected = 0
+	}
+	return m, cmd
+}
+
+func (m model) selectedHistory() (historyEntry, bool) {
+	if m.historySelected < 0 || m.historySelected >= len(m.historyMatches) {
+		return historyEntry{}, false
+	}
+	return m.historyMatches[m.historySelected], true
+}
+
+func (m model) renderHistoryOverlay() string {
+	var b strings.Builder
+
+	titleStyle := m.theme.fg(m.theme.accent).Bold(true)
+	selectedStyle := m.theme.fill(m.theme.selectedBG, m.theme.selectedFG).Bold(true)
+	normalStyle := m.theme.fg(m.theme.text)
+	metaStyle := m.theme.fg(m.theme.muted)
+
+	b.WriteString(titleStyle.Render("History"))
+	b.WriteString("\n")
+	b.WriteString(m.historyQuery.View())
+	b.WriteString("\n")
+
+	if len(m.historyMatches) == 0 {
+		b.WriteString(metaStyle.Italic(true).Render("(no matches)"))
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	// Keep the selection visible within the available height.
+	maxRows := m.height - 5
+	if maxRows < 3 {
+		maxRows = 3
+	}
+	start := 0
+	if m.historySelected >= maxRows {
+		start = m.historySelected - maxRows + 1
+	}
+	end := start + maxRows
+	if end > len(m.historyMatches) {
+		end = len(m.historyMatches)
+	}
+
+	width := m.width - 4
+	if width < 20 {
+		width = 20
+	}
+	for i := start; i < end; i++ {
+		e := m.historyMatches[i]
+		line := cleanText(e.Prompt)
+		if e.Choice != "" {
+			line += "  " + m.theme.glyphs.arrow + " " + cleanText(e.Choice)
+		}
+		line = runewidth.Truncate(line, width, m.theme.glyphs.ellipsis)
+		meta := fmt.Sprintf("  %s %s %s", e.CLI, m.theme.glyphs.bullet, e.Time.Format("Jan 2 15:04"))
+		if i == m.historySelected {
+			b.WriteString(selectedStyle.Render(m.theme.glyphs.selected + " " + line))
+		} else {
+			b.WriteString(normalStyle.Render("  " + line))
+		}
+		b.WriteString(metaStyle.Render(meta))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package instassist
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	entries := []historyEntry{
+		{Time: time.Unix(1, 0), CLI: "codex", Prompt: "find large files"},
+		{Time: time.Unix(2, 0), CLI: "codex", Prompt: "find large files", Choice: "du -ah . | sort -rh | head", Action: actionCopied},
+		{Time: time.Unix(3, 0), CLI: "claude", Prompt: "undo last commit"},
+		{Time: time.Unix(4, 0), CLI: "claude", Prompt: "undo last commit", Choice: "git reset --soft HEAD~2", Action: actionExecuted, Original: "git reset --soft HEAD~1"},
+	}
+	for _, e := range entries {
+		if err := appendHistory(e); err != nil {
+			t.Fatalf("appendHistory returned error: %v", err)
+		}
+	}
+
+	loaded, err := loadHistory()
+	if err != nil {
+		t.Fatalf("loadHistory returned error: %v", err)
+	}
+	if len(loaded) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(loaded))
+	}
+	if loaded[1].Choice != entries[1].Choice || loaded[1].Action != actionCopied {
+		t.Fatalf("choice not preserved: %+v", loaded[1])
+	}
+
+	if got, want := recentPrompts(loaded), []string{"undo last commit", "find large files"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("recentPrompts = %q, want %q", got, want)
+	}
+	if loaded[3].Original != entries[3].Original {
+		t.Fatalf("original command not preserved: %+v", loaded[3])
+	}
+
+	if got := historyItems(loaded); len(got) != 4 || got[0].Prompt != "undo last commit" {
+		t.Fatalf("unexpected history items: %+v", got)
+	}
+}
+
+func TestLoadHistoryMissingFile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	entries, err := loadHistory()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty history without error, got %v, %v", entries, err)
+	}
+}
+
+func TestFilterHistoryFuzzy(t *testing.T) {
+	items := []historyEntry{
+		{Prompt: "show disk usage"},
+		{Prompt: "docker prune images"},
+		{Prompt: "list docker containers"},
+	}
+
+	got := filterHistory(items, "dkr")
+	if len(got) != 2 {
+		t.Fatalf("expected 2 matches for subsequence, got %+v", got)
+	}
+
+	got = filterHistory(items, "docker c")
+	if len(got) != 1 || got[0].Prompt != "list docker containers" {
+		t.Fatalf("unexpected matches: %+v", got)
+	}
+
+	if got := filterHistory(items, ""); len(got) != len(items) {
+		t.Fatalf("empty query should match everything, got %d", len(got))
+	}
+
+	if _, ok := fuzzyScore("xyz", "docker"); ok {
+		t.Fatalf("expected no match")
+	}
+	contiguous, _ := fuzzyScore("disk", "show disk usage")
+	scattered, _ := fuzzyScore("disk", "docker images size kill")
+	if contiguous <= scattered {
+		t.Fatalf("expected contiguous match to score higher (%d vs %d)", contiguous, scattered)
+	}
+}
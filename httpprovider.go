@@ -0,0 +1,322 @@
+package instassist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpSettings configures a native HTTP backend. keyEnv names the
+// environment variable holding the API key rather than the key itself.
+type httpSettings struct {
+	baseURL string
+	model   string
+	keyEnv  string
+}
+
+func (s httpSettings) apiKey() string {
+	if s.keyEnv == "" {
+		return ""
+	}
+	return os.Getenv(s.keyEnv)
+}
+
+func (s httpSettings) endpoint(path string) string {
+	return strings.TrimRight(s.baseURL, "/") + path
+}
+
+// httpProvider talks to a chat API directly instead of shelling out.
+type httpProvider struct {
+	id       string
+	settings httpSettings
+	client   *http.Client
+	// isAvailable reports whether the backend is configured or reachable.
+	isAvailable func(s httpSettings) bool
+	// build returns the request path, extra headers and JSON payload.
+	build func(s httpSettings, req providerRequest) (string, map[string]string, any)
+	// decode extracts the model's options JSON from a response body.
+	decode func(body []byte) ([]byte, error)
+}
+
+func (p httpProvider) name() string {
+	return p.id
+}
+
+func (p httpProvider) available() bool {
+	return p.isAvailable(p.settings)
+}
+
+func (p httpProvider) caps() providerCaps {
+	return providerCaps{schema: true}
+}
+
+func (p httpProvider) run(ctx context.Context, req providerRequest) ([]byte, error) {
+	path, headers, payload := p.build(p.settings, req)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", p.id, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.settings.endpoint(path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", p.id, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return respBody, fmt.Errorf("%s returned HTTP %d", p.id, resp.StatusCode)
+	}
+
+	out, err := p.decode(respBody)
+	if err != nil {
+		return respBody, err
+	}
+	return out, nil
+}
+
+// resume is never used: HTTP backends are stateless and do not advertise
+// resume support, so sendPrompt always starts a fresh run.
+func (p httpProvider) resume(ctx context.Context, req providerRequest, sessionID string) ([]byte, error) {
+	return p.run(ctx, req)
+}
+
+func rawSchema(req providerRequest) json.RawMessage {
+	if strings.TrimSpace(req.schema.json) == "" {
+		return nil
+	}
+	return json.RawMessage(req.schema.json)
+}
+
+func newOpenAIProvider(s httpSettings) httpProvider {
+	return httpProvider{
+		id:       "openai",
+		settings: s,
+		isAvailable: func(s httpSettings) bool {
+			// A custom base URL usually means a local OpenAI-compatible
+			// server, which often needs no key.
+			return s.apiKey() != "" || s.baseURL != defaultOpenAIBaseURL
+		},
+		build: func(s httpSettings, req providerRequest) (string, map[string]string, any) {
+			headers := map[string]string{}
+			if key := s.apiKey(); key != "" {
+				headers["Authorization"] = "Bearer " + key
+			}
+			payload := map[string]any{
+				"model":    s.model,
+				"messages": []map[string]string{{"role": "user", "content": req.prompt}},
+			}
+			if schema := rawSchema(req); schema != nil {
+				payload["response_format"] = map[string]any{
+					"type": "json_schema",
+					"json_schema": map[string]any{
+						"name":   "options",
+						"schema": schema,
+					},
+				}
+			}
+			return "/chat/completions", headers, payload
+		},
+		decode: func(body []byte) ([]byte, error) {
+			var resp struct {
+				Choices []struct {
+					Message struct {
+						Content string `json:"content"`
+					} `json:"message"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, fmt.Errorf("failed to decode openai response: %w", err)
+			}
+			if len(resp.Choices) == 0 {
+				return nil, fmt.Errorf("openai response has no choices")
+			}
+			return []byte(resp.Choices[0].Message.Content), nil
+		},
+	}
+}
+
+const anthropicToolName = "submit_options"
+
+func newAnthropicProvider(s httpSettings) httpProvider {
+	return httpProvider{
+		id:       "anthropic",
+		settings: s,
+		isAvailable: func(s httpSettings) bool {
+			return s.apiKey() != ""
+		},
+		build: func(s httpSettings, req providerRequest) (string, map[string]string, any) {
+			headers := map[string]string{
+				"x-api-key":         s.apiKey(),
+				"anthropic-version": "2023-06-01",
+			}
+			payload := map[string]any{
+				"model":      s.model,
+				"max_tokens": 2048,
+				"messages":   []map[string]string{{"role": "user", "content": req.prompt}},
+			}
+			// Structured output is obtained by forcing a single tool call
+			// whose input schema is the options schema.
+			if schema := rawSchema(req); schema != nil {
+				payload["tools"] = []map[string]any{{
+					"name":         anthropicToolName,
+					"description":  "Return the suggested options.",
+					"input_schema": schema,
+				}}
+				payload["tool_choice"] = map[string]string{"type": "tool", "name": anthropicToolName}
+			}
+			return "/v1/messages", headers, payload
+		},
+		decode: func(body []byte) ([]byte, error) {
+			var resp struct {
+				Content []struct {
+					Type  string          `json:"type"`
+					Text  string          `json:"text"`
+					Name  string          `json:"name"`
+					Input json.RawMessage `json:"input"`
+				} `json:"content"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+			}
+			var text strings.Builder
+			for _, block := range resp.Content {
+				switch block.Type {
+				case "tool_use":
+					if block.Name == anthropicToolName && len(block.Input) > 0 {
+						return block.Input, nil
+					}
+				case "text":
+					text.WriteString(block.Text)
+				}
+			}
+			if text.Len() == 0 {
+				return nil, fmt.Errorf("anthropic response has no content")
+			}
+			return []byte(text.String()), nil
+		},
+	}
+}
+
+func newOllamaProvider(s httpSettings) httpProvider {
+	return httpProvider{
+		id:       "ollama",
+		settings: s,
+		isAvailable: func(s httpSettings) bool {
+			u, err := url.Parse(s.baseURL)
+			if err != nil || u.Host == "" {
+				return false
+			}
+			host := u.Host
+			if u.Port() == "" {
+				host = net.JoinHostPort(u.Hostname(), "11434")
+			}
+			conn, err := net.DialTimeout("tcp", host, 200*time.Millisecond)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		},
+		build: func(s httpSettings, req providerRequest) (string, map[string]string, any) {
+			payload := map[string]any{
+				"model":    s.model,
+				"messages": []map[string]string{{"role": "user", "content": req.prompt}},
+				"stream":   false,
+			}
+			if schema := rawSchema(req); schema != nil {
+				payload["format"] = schema
+			}
+			return "/api/chat", nil, payload
+		},
+		decode: func(body []byte) ([]byte, error) {
+			var resp struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+			}
+			if resp.Error != "" {
+				return nil, fmt.Errorf("ollama: %s", resp.Error)
+			}
+			return []byte(resp.Message.Content), nil
+		},
+	}
+}
+
+const (
+	defaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	defaultOllamaBaseURL    = "http://localhost:11434"
+)
+
+// httpProviders builds the native HTTP backends from the environment.
+// INST_<NAME>_BASE_URL, INST_<NAME>_MODEL and INST_<NAME>_KEY_ENV override
+// the defaults.
+func httpProviders() []provider {
+	ollamaBase := defaultOllamaBaseURL
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		ollamaBase = host
+	}
+
+	return []provider{
+		newOpenAIProvider(httpSettingsFromEnv("OPENAI", httpSettings{
+			baseURL: defaultOpenAIBaseURL,
+			model:   "gpt-4o-mini",
+			keyEnv:  "OPENAI_API_KEY",
+		})),
+		newAnthropicProvider(httpSettingsFromEnv("ANTHROPIC", httpSettings{
+			baseURL: defaultAnthropicBaseURL,
+			model:   "claude-sonnet-4-5",
+			keyEnv:  "ANTHROPIC_API_KEY",
+		})),
+		newOllamaProvider(httpSettingsFromEnv("OLLAMA", httpSettings{
+			baseURL: ollamaBase,
+			model:   "llama3.2",
+		})),
+	}
+}
+
+func httpSettingsFromEnv(name string, defaults httpSettings) httpSettings {
+	s := defaults
+	if v := os.Getenv("INST_" + name + "_BASE_URL"); v != "" {
+		s.baseURL = v
+	}
+	if v := os.Getenv("INST_" + name + "_MODEL"); v != "" {
+		s.model = v
+	}
+	if v := os.Getenv("INST_" + name + "_KEY_ENV"); v != "" {
+		s.keyEnv = v
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package instassist
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testSchemaJSON = `{"type":"object","properties":{"options":{"type":"array"}}}`
+
+func stubServer(t *testing.T, wantPath string, check func(body map[string]any, r *http.Request), reply string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != wantPath {
+			t.Errorf("unexpected path %q, want %q", r.URL.Path, wantPath)
+		}
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		check(body, r)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func runStub(t *testing.T, p httpProvider) []optionEntry {
+	t.Helper()
+	req := providerRequest{prompt: "list files", schema: schemaSpec{json: testSchemaJSON}}
+	out, err := p.run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("run returned error: %v (output %s)", err, out)
+	}
+	opts, err := extractOptions(string(out))
+	if err != nil {
+		t.Fatalf("extractOptions returned error: %v (output %s)", err, out)
+	}
+	return opts
+}
+
+func TestOpenAIProviderSendsSchemaAndParsesContent(t *testing.T) {
+	t.Setenv("TEST_OPENAI_KEY", "sk-test")
+	srv := stubServer(t, "/v1/chat/completions", func(body map[string]any, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		if body["model"] != "test-model" {
+			t.Errorf("unexpected model %v", body["model"])
+		}
+		format, _ := body["response_format"].(map[string]any)
+		if format["type"] != "json_schema" {
+			t.Errorf("expected json_schema response_format, got %v", body["response_format"])
+		}
+	}, `{"choices":[{"message":{"content":"{\"options\":[{\"value\":\"ls\",\"description\":\"list\",\"recommendation_order\":1}]}"}}]}`)
+
+	p := newOpenAIProvider(httpSettings{baseURL: srv.URL + "/v1", model: "test-model", keyEnv: "TEST_OPENAI_KEY"})
+	opts := runStub(t, p)
+	if len(opts) != 1 || opts[0].Value != "ls" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+}
+
+func TestAnthropicProviderUsesToolInput(t *testing.T) {
+	t.Setenv("TEST_ANTHROPIC_KEY", "ak-test")
+	srv := stubServer(t, "/v1/messages", func(body map[string]any, r *http.Request) {
+		if got := r.Header.Get("x-api-key"); got != "ak-test" {
+			t.Errorf("unexpected x-api-key header %q", got)
+		}
+		choice, _ := body["tool_choice"].(map[string]any)
+		if choice["name"] != anthropicToolName {
+			t.Errorf("expected forced tool choice, got %v", body["tool_choice"])
+		}
+	}, `{"content":[{"type":"tool_use","name":"submit_options","input":{"options":[{"value":"pwd","description":"where","recommendation_order":1}]}}]}`)
+
+	p := newAnthropicProvider(httpSettings{baseURL: srv.URL, model: "test-model", keyEnv: "TEST_ANTHROPIC_KEY"})
+	opts := runStub(t, p)
+	if len(opts) != 1 || opts[0].Value != "pwd" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+}
+
+func TestOllamaProviderSendsFormat(t *testing.T) {
+	srv := stubServer(t, "/api/chat", func(body map[string]any, r *http.Request) {
+		if _, ok := body["format"].(map[string]any); !ok {
+			t.Errorf("expected schema in format, got %v", body["format"])
+		}
+		if body["stream"] != false {
+			t.Errorf("expected stream=false, got %v", body["stream"])
+		}
+	}, `{"message":{"role":"assistant","content":"{\"options\":[{\"value\":\"df -h\",\"description\":\"disk\",\"recommendation_order\":1}]}"}}`)
+
+	p := newOllamaProvider(httpSettings{baseURL: srv.URL, model: "test-model"})
+	if !p.available() {
+		t.Fatalf("expected stub server to be reported as available")
+	}
+	opts := runStub(t, p)
+	if len(opts) != 1 || opts[0].Value != "df -h" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+}
+
+func TestHTTPProviderReportsStatusErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":"bad key"}`)
+	}))
+	defer srv.Close()
+
+	p := newOpenAIProvider(httpSettings{baseURL: srv.URL, model: "m"})
+	out, err := p.run(context.Background(), providerRequest{prompt: "x"})
+	if err == nil {
+		t.Fatalf("expected error for HTTP 401")
+	}
+	if string(out) != `{"error":"bad key"}` {
+		t.Fatalf("expected response body to be returned, got %q", out)
+	}
+}
@@ -0,0 +1,449 @@
+package instassist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const helpKeys = "esc/?/q: close • ctrl+c: quit"
+
+// keyMap holds the rebindable keys of the prompt input and the options
+// list. The overlays (history, edit, parameters, explain, output) keep
+// their own keys, and ctrl+c always quits.
+type keyMap struct {
+	// Prompt input, for new prompts and refines.
+	Send    key.Binding
+	SendRun key.Binding
+	Newline key.Binding
+	Compare key.Binding
+	Mode    key.Binding
+	Context key.Binding
+	Preview key.Binding
+	History key.Binding
+	NextCLI key.Binding
+	PrevCLI key.Binding
+	Exit    key.Binding
+
+	// Options list.
+	Copy         key.Binding
+	Run          key.Binding
+	Edit         key.Binding
+	EditExternal key.Binding
+	Explain      key.Binding
+	Refine       key.Binding
+	Refresh      key.Binding
+	NewPrompt    key.Binding
+	Fix          key.Binding
+	Up           key.Binding
+	Down         key.Binding
+	Quit         key.Binding
+
+	// Both.
+	Yolo key.Binding
+	Help key.Binding
+}
+
+// bind creates a binding whose help shows all of its keys.
+func bind(desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(strings.Join(keys, "/"), desc))
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Send:    bind("send", "enter"),
+		SendRun: bind("send & run", "ctrl+r"),
+		Newline: bind("newline", "alt+enter", "ctrl+j"),
+		Compare: bind("compare", "ctrl+a"),
+		Mode:    bind("mode", "ctrl+t"),
+		Context: bind("toggle context", "ctrl+x"),
+		Preview: bind("preview", "ctrl+o"),
+		History: bind("history", "ctrl+h"),
+		NextCLI: bind("next CLI", "ctrl+n"),
+		PrevCLI: bind("previous CLI", "ctrl+p"),
+		Exit:    bind("exit", "esc"),
+
+		Copy:         bind("copy & exit", "enter"),
+		Run:          bind("run & exit", "ctrl+r"),
+		Edit:         bind("edit", "e"),
+		EditExternal: bind("edit in $EDITOR", "E"),
+		Explain:      bind("explain", "x"),
+		Refine:       bind("refine", "a"),
+		Refresh:      bind("refresh", "r"),
+		NewPrompt:    bind("new prompt", "n"),
+		Fix:          bind("fix failed run", "f"),
+		Up:           bind("previous option", "up", "k"),
+		Down:         bind("next option", "down", "j"),
+		Quit:         bind("quit", "esc", "q"),
+
+		Yolo: bind("toggle yolo", "ctrl+y"),
+		Help: bind("help", "?"),
+	}
+}
+
+// keyAction is a rebindable action as named in the [keys] config table.
+type keyAction struct {
+	name    string
+	binding func(*keyMap) *key.Binding
+	input   bool // active while typing a prompt
+	options bool // active in the options list
+	running bool // active on options that stream in before the provider exits
+}
+
+var keyActions = []keyAction{
+	{"send", func(k *keyMap) *key.Binding { return &k.Send }, true, false, false},
+	{"send_and_run", func(k *keyMap) *key.Binding { return &k.SendRun }, true, false, false},
+	{"newline", func(k *keyMap) *key.Binding { return &k.Newline }, true, true, false},
+	{"compare", func(k *keyMap) *key.Binding { return &k.Compare }, true, false, false},
+	{"mode", func(k *keyMap) *key.Binding { return &k.Mode }, true, false, false},
+	{"toggle_context", func(k *keyMap) *key.Binding { return &k.Context }, true, false, false},
+	{"preview", func(k *keyMap) *key.Binding { return &k.Preview }, true, false, false},
+	{"history", func(k *keyMap) *key.Binding { return &k.History }, true, false, false},
+	{"next_cli", func(k *keyMap) *key.Binding { return &k.NextCLI }, true, false, false},
+	{"prev_cli", func(k *keyMap) *key.Binding { return &k.PrevCLI }, true, false, false},
+	{"exit", func(k *keyMap) *key.Binding { return &k.Exit }, true, false, false},
+	{"copy", func(k *keyMap) *key.Binding { return &k.Copy }, false, true, true},
+	{"run", func(k *keyMap) *key.Binding { return &k.Run }, false, true, true},
+	{"edit", func(k *keyMap) *key.Binding { return &k.Edit }, false, true, false},
+	{"edit_external", func(k *keyMap) *key.Binding { return &k.EditExternal }, false, true, false},
+	{"explain", func(k *keyMap) *key.Binding { return &k.Explain }, false, true, false},
+	{"refine", func(k *keyMap) *key.Binding { return &k.Refine }, false, true, false},
+	{"refresh", func(k *keyMap) *key.Binding { return &k.Refresh }, false, true, false},
+	{"new_prompt", func(k *keyMap) *key.Binding { return &k.NewPrompt }, false, true, false},
+	{"fix", func(k *keyMap) *key.Binding { return &k.Fix }, false, true, false},
+	{"up", func(k *keyMap) *key.Binding { return &k.Up }, false, true, true},
+	{"down", func(k *keyMap) *key.Binding { return &k.Down }, false, true, true},
+	{"quit", func(k *keyMap) *key.Binding { return &k.Quit }, false, true, false},
+	{"toggle_yolo", func(k *keyMap) *key.Binding { return &k.Yolo }, true, true, false},
+	{"help", func(k *keyMap) *key.Binding { return &k.Help }, true, true, false},
+}
+
+func keyActionNames() []string {
+	names := make([]string, len(keyActions))
+	for i, a := range keyActions {
+		names[i] = a.name
+	}
+	return names
+}
+
+// fixedKey is a key the UI handles itself, before or instead of the
+// rebindable actions active in the same place.
+type fixedKey struct {
+	key, name               string
+	input, options, running bool
+}
+
+var fixedKeys = []fixedKey{
+	{"ctrl+c", "quit", true, true, true},
+	{"tab", "insert tab", true, false, false},
+	{"up", "previous prompt", true, false, false},
+	{"down", "next prompt", true, false, false},
+	{"esc", "cancel request", false, false, true},
+}
+
+// keyNames are the keys Bubble Tea reports by name. Everything else it
+// reports is a single character, optionally with alt+ in front.
+var keyNames = func() map[string]bool {
+	names := map[string]bool{}
+	for t := tea.KeyF20; t <= tea.KeyBackspace; t++ {
+		if s := t.String(); s != "" && t != tea.KeyRunes {
+			names[s] = true
+		}
+	}
+	return names
+}()
+
+// validKey reports whether k can ever match a key press.
+func validKey(k string) bool {
+	name := strings.TrimPrefix(k, "alt+")
+	if keyNames[name] {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return size > 0 && size == len(name) && unicode.IsPrint(r) && !unicode.IsSpace(r)
+}
+
+// keyList is a [keys] entry: one key or a list of them.
+type keyList []string
+
+func (l *keyList) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*l = keyList{v}
+	case []any:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("keys must be strings")
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return fmt.Errorf("expected a key or a list of keys")
+	}
+	return nil
+}
+
+// rebind applies [keys] entries on top of k.
+func (k *keyMap) rebind(entries map[string]keyList) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		keys := entries[name]
+		var action *keyAction
+		for i := range keyActions {
+			if keyActions[i].name == name {
+				action = &keyActions[i]
+			}
+		}
+		if action == nil {
+			return fmt.Errorf("keys: unknown action %q (valid: %s)", name, strings.Join(keyActionNames(), ", "))
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("keys: %s needs at least one key", name)
+		}
+		for _, k := range keys {
+			if !validKey(k) {
+				return fmt.Errorf("keys: %s: unknown key %q (use names like ctrl+s, alt+enter, shift+tab, f2 or a single character)", name, k)
+			}
+		}
+		b := action.binding(k)
+		b.SetKeys(keys...)
+		b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+	}
+	return nil
+}
+
+// conflicts lists keys bound to more than one action that are active at
+// the same time, e.g. "ctrl+s: send, preview", including the fixed keys
+// such as "tab: insert tab (fixed), send".
+func (k keyMap) conflicts() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, scope := range []struct {
+		fixed  func(fixedKey) bool
+		action func(keyAction) bool
+	}{
+		{func(f fixedKey) bool { return f.input }, func(a keyAction) bool { return a.input }},
+		{func(f fixedKey) bool { return f.options }, func(a keyAction) bool { return a.options }},
+		{func(f fixedKey) bool { return f.running }, func(a keyAction) bool { return a.running }},
+	} {
+		users := map[string][]string{}
+		var order []string
+		use := func(pressed, name string) {
+			if users[pressed] == nil {
+				order = append(order, pressed)
+			}
+			users[pressed] = append(users[pressed], name)
+		}
+		for _, f := range fixedKeys {
+			if scope.fixed(f) {
+				use(f.key, f.name+" (fixed)")
+			}
+		}
+		for _, a := range keyActions {
+			if !scope.action(a) {
+				continue
+			}
+			for _, pressed := range a.binding(&k).Keys() {
+				use(pressed, a.name)
+			}
+		}
+		for _, pressed := range order {
+			conflict := pressed + ": " + strings.Join(users[pressed], ", ")
+			if len(users[pressed]) > 1 && !seen[conflict] {
+				seen[conflict] = true
+				out = append(out, conflict)
+			}
+		}
+	}
+	return out
+}
+
+// inlineTable prints the rebound actions as a TOML inline table for
+// inst config, e.g. { send = ["ctrl+s"] }.
+func (k keyMap) inlineTable() string {
+	defaults := defaultKeyMap()
+	var parts []string
+	for _, a := range keyActions {
+		keys := a.binding(&k).Keys()
+		if strings.Join(keys, "\x00") != strings.Join(a.binding(&defaults).Keys(), "\x00") {
+			parts = append(parts, a.name+" = "+quoteList(keys))
+		}
+	}
+	if len(parts) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+func helpOf(bindings ...key.Binding) []key.Help {
+	out := make([]key.Help, 0, len(bindings))
+	for _, b := range bindings {
+		if b.Enabled() {
+			out = append(out, b.Help())
+		}
+	}
+	return out
+}
+
+// withDesc is b's help with another description, e.g. send as "refine".
+func withDesc(b key.Binding, desc string) key.Help {
+	return key.Help{Key: b.Help().Key, Desc: desc}
+}
+
+// firstKey is the key shown for b where there is room for only one.
+func firstKey(b key.Binding) string {
+	if keys := b.Keys(); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// cliHint is the header hint for switching providers, "ctrl+n/p" by
+// default.
+func (k keyMap) cliHint() string {
+	next, prev := firstKey(k.NextCLI), firstKey(k.PrevCLI)
+	if strings.HasPrefix(next, "ctrl+") && strings.HasPrefix(prev, "ctrl+") {
+		return next + "/" + strings.TrimPrefix(prev, "ctrl+")
+	}
+	return next + "/" + prev
+}
+
+// navigateHelp combines up and down as "up/down: navigate".
+func (k keyMap) navigateHelp() key.Help {
+	return key.Help{Key: firstKey(k.Up) + "/" + firstKey(k.Down), Desc: "navigate"}
+}
+
+func (k keyMap) inputHelp() []key.Help {
+	return helpOf(k.Send, k.SendRun, k.Compare, k.Mode, k.Yolo, k.Context, k.Preview, k.History, k.Newline, k.Exit, k.Help)
+}
+
+func (k keyMap) viewingHelp() []key.Help {
+	edit := key.Help{Key: firstKey(k.Edit) + "/" + firstKey(k.EditExternal), Desc: "edit"}
+	return append(append(helpOf(k.Copy, k.Run), edit), helpOf(k.Explain, k.Refine, k.Refresh, k.NewPrompt, k.Yolo, k.Quit, k.Help)...)
+}
+
+func (k keyMap) refineHelp() []key.Help {
+	return append([]key.Help{withDesc(k.Send, "refine"), withDesc(k.SendRun, "refine & run")}, helpOf(k.Yolo, k.Newline, k.Exit)...)
+}
+
+// editHelp covers the inline command editor, which copies on enter and
+// otherwise types keys into the command.
+func (k keyMap) editHelp() []key.Help {
+	return append(append([]key.Help{{Key: "enter", Desc: "copy & exit"}, withDesc(k.Run, "run")}, helpOf(k.Newline)...), key.Help{Key: "esc", Desc: "back"})
+}
+
+func (k keyMap) runningOptionsHelp() []key.Help {
+	return append(helpOf(k.Copy, k.Run), k.navigateHelp(), key.Help{Key: "esc", Desc: "cancel"}, key.Help{Key: "ctrl+c", Desc: "quit"})
+}
+
+// helpText renders help entries as the plain status line.
+func helpText(entries []key.Help) string {
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		parts[i] = e.Key + ": " + e.Desc
+	}
+	return strings.Join(parts, " • ")
+}
+
+func (m model) helpInput() string          { return helpText(m.keys.inputHelp()) }
+func (m model) helpViewing() string        { return helpText(m.keys.viewingHelp()) }
+func (m model) helpRefine() string         { return helpText(m.keys.refineHelp()) }
+func (m model) helpEdit() string           { return helpText(m.keys.editHelp()) }
+func (m model) helpRunningOptions() string { return helpText(m.keys.runningOptionsHelp()) }
+
+// statusHelp returns the entries of the status line when it shows one of
+// the generated help lines, so it can be rendered with styled keys.
+func (m model) statusHelp() []key.Help {
+	for _, entries := range [][]key.Help{m.keys.inputHelp(), m.keys.viewingHelp(), m.keys.refineHelp(), m.keys.editHelp(), m.keys.runningOptionsHelp()} {
+		if m.status == helpText(entries) {
+			return entries
+		}
+	}
+	return nil
+}
+
+// helpLine styles a help line: keys highlighted, descriptions and
+// separators dimmed.
+func (t uiTheme) helpLine(entries []key.Help) string {
+	keyStyle := t.fg(t.accent).Bold(true)
+	descStyle := t.fg(t.muted)
+
+	var b strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString(descStyle.Render(t.glyphs.bullet + " "))
+		}
+		for j, k := range strings.Split(e.Key, "/") {
+			if j > 0 {
+				b.WriteString(descStyle.Render("/"))
+			}
+			b.WriteString(keyStyle.Render(k))
+		}
+		desc := ": " + e.Desc
+		if i < len(entries)-1 {
+			desc += " "
+		}
+		b.WriteString(descStyle.Render(desc))
+	}
+	return b.String()
+}
+
+// openHelp shows every binding of the active keymap.
+func (m model) openHelp() (tea.Model, tea.Cmd) {
+	m.helpReturn = m.mode
+	m.helpStatus = m.status
+	m.mode = modeHelp
+	m.status = helpKeys
+	m.input.Blur()
+	return m, nil
+}
+
+func (m model) handleHelpKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc" || msg.String() == "q" || key.Matches(msg, m.keys.Help):
+		m.mode = m.helpReturn
+		m.status = m.helpStatus
+		if m.mode == modeInput || m.mode == modeRefine {
+			m.input.Focus()
+		}
+	}
+	return m, nil
+}
+
+func (m model) renderHelp() string {
+	titleStyle := m.theme.fg(m.theme.accent).Bold(true)
+	noteStyle := m.theme.fg(m.theme.muted)
+	k := m.keys
+
+	h := help.New()
+	h.Styles.FullKey = m.theme.fg(m.theme.accent).Bold(true)
+	h.Styles.FullDesc = noteStyle
+	column := func(title string, bindings ...key.Binding) string {
+		return titleStyle.Render(title) + "\n" + h.FullHelpView([][]key.Binding{bindings})
+	}
+
+	var b strings.Builder
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top,
+		column("Prompt", k.Send, k.SendRun, k.Newline, k.Compare, k.Mode, k.Context, k.Preview, k.History, k.NextCLI, k.PrevCLI, k.Yolo, k.Exit),
+		"      ",
+		column("Options", k.Copy, k.Run, k.Edit, k.EditExternal, k.Explain, k.Refine, k.Refresh, k.NewPrompt, k.Fix, k.Up, k.Down, k.Yolo, k.Quit),
+	))
+	b.WriteString("\n\n")
+	b.WriteString(noteStyle.Render("Rebind these in the [keys] table of config.toml. ctrl+c always quits."))
+	b.WriteString("\n")
+	return b.String()
+}
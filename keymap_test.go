@@ -0,0 +1,180 @@
+package instassist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestConfigRebindsKeys(t *testing.T) {
+	var layer fileConfig
+	data := "[keys]\nsend = \"ctrl+s\"\nrefine = [\"R\", \"ctrl+e\"]\n"
+	if err := parseConfig(data, &layer); err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	cfg := defaultConfig()
+	if err := cfg.merge(layer, "test"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if !cfg.keys.Send.Enabled() || strings.Join(cfg.keys.Send.Keys(), ",") != "ctrl+s" {
+		t.Errorf("expected send on ctrl+s, got %v", cfg.keys.Send.Keys())
+	}
+	if got := cfg.keys.Refine.Help(); got.Key != "R/ctrl+e" || got.Desc != "refine" {
+		t.Errorf("expected the refine help to follow its keys, got %+v", got)
+	}
+	if cfg.sources["keys"] != "test" {
+		t.Errorf("expected keys from test, got %q", cfg.sources["keys"])
+	}
+
+	m := model{keys: cfg.keys}
+	if !strings.HasPrefix(m.helpInput(), "ctrl+s: send • ") {
+		t.Errorf("expected the help line to show the new send key, got %q", m.helpInput())
+	}
+	if !strings.Contains(m.helpViewing(), "R/ctrl+e: refine") {
+		t.Errorf("expected the help line to show the new refine keys, got %q", m.helpViewing())
+	}
+
+	var out bytes.Buffer
+	writeConfig(&out, cfg, nil)
+	if !strings.Contains(out.String(), `keys = { send = ["ctrl+s"], refine = ["R", "ctrl+e"] }`) {
+		t.Errorf("expected config show to list the rebound keys, got:\n%s", out.String())
+	}
+}
+
+func TestConfigRejectsInvalidKeys(t *testing.T) {
+	for _, data := range []string{
+		"[keys]\nlaunch = \"ctrl+l\"\n",
+		"[keys]\nsend = []\n",
+		"[keys]\nsend = \"ctrl + s\"\n",
+		"[keys]\nsend = \"Ctrl+S\"\n",
+		"[keys]\nsend = \"control+s\"\n",
+		"[keys]\nsend = \"ctrl+enter \"\n",
+		"[keys]\nrefine = [\"R\", \"enter\", \"Enter\"]\n",
+		"[keys]\nsend = 1\n",
+	} {
+		var layer fileConfig
+		err := parseConfig(data, &layer)
+		if err == nil {
+			cfg := defaultConfig()
+			err = cfg.merge(layer, "test")
+		}
+		if err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	for k, want := range map[string]bool{
+		"ctrl+s": true, "alt+enter": true, "shift+tab": true, "f12": true, "?": true, "E": true, "alt+x": true, " ": true, "ctrl+pgup": true,
+		"Ctrl+S": false, "ctrl+S": false, "control+s": false, "ctrl+enter": false, "enter ": false, "": false, "alt+": false, "ab": false, "space": false,
+	} {
+		if got := validKey(k); got != want {
+			t.Errorf("validKey(%q) = %v, want %v", k, got, want)
+		}
+	}
+}
+
+func TestDefaultKeysAreValid(t *testing.T) {
+	k := defaultKeyMap()
+	for _, a := range keyActions {
+		for _, pressed := range a.binding(&k).Keys() {
+			if !validKey(pressed) {
+				t.Errorf("default key %q of %s can never match", pressed, a.name)
+			}
+		}
+	}
+
+	// Writing out the defaults is accepted.
+	var layer fileConfig
+	if err := parseConfig("[keys]\nsend = \"enter\"\nnewline = [\"alt+enter\", \"ctrl+j\"]\n", &layer); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	if err := cfg.merge(layer, "test"); err != nil {
+		t.Errorf("expected the default keys to be accepted, got %v", err)
+	}
+}
+
+func TestKeyConflicts(t *testing.T) {
+	if conflicts := defaultKeyMap().conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected the default keymap to have no conflicts, got %v", conflicts)
+	}
+
+	k := defaultKeyMap()
+	if err := k.rebind(map[string]keyList{"preview": {"ctrl+r"}, "explain": {"ctrl+r"}}); err != nil {
+		t.Fatal(err)
+	}
+	conflicts := k.conflicts()
+	// ctrl+r is send_and_run and preview in the input, run and explain in
+	// the options list.
+	want := []string{"ctrl+r: send_and_run, preview", "ctrl+r: run, explain"}
+	if strings.Join(conflicts, "; ") != strings.Join(want, "; ") {
+		t.Errorf("expected %v, got %v", want, conflicts)
+	}
+
+	// Keys the UI handles itself count too.
+	k = defaultKeyMap()
+	if err := k.rebind(map[string]keyList{"send": {"tab"}, "copy": {"esc"}, "quit": {"q"}}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"tab: insert tab (fixed), send", "esc: cancel request (fixed), copy"}
+	if conflicts := k.conflicts(); strings.Join(conflicts, "; ") != strings.Join(want, "; ") {
+		t.Errorf("expected %v, got %v", want, conflicts)
+	}
+
+	// The same key in different scopes is fine.
+	k = defaultKeyMap()
+	k.rebind(map[string]keyList{"explain": {"ctrl+o"}})
+	if conflicts := k.conflicts(); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts across scopes, got %v", conflicts)
+	}
+}
+
+func TestReboundKeysDriveTheModel(t *testing.T) {
+	k := defaultKeyMap()
+	if err := k.rebind(map[string]keyList{"toggle_yolo": {"ctrl+g"}, "help": {"f1"}}); err != nil {
+		t.Fatal(err)
+	}
+	m := model{keys: k, mode: modeViewing}
+
+	next, _ := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlY})
+	if next.(model).yolo {
+		t.Errorf("expected ctrl+y to no longer toggle yolo")
+	}
+	next, _ = m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlG})
+	if !next.(model).yolo {
+		t.Errorf("expected ctrl+g to toggle yolo")
+	}
+
+	// The inline editor follows the rebound newline and run keys, and
+	// printable keys are still typed into the command.
+	if err := k.rebind(map[string]keyList{"newline": {"ctrl+o"}, "run": {"ctrl+e", "z"}}); err != nil {
+		t.Fatal(err)
+	}
+	m.keys = k
+	edit, _ := m.openEdit(optionEntry{Value: "ls"}, "ls")
+	if status := edit.(model).status; status != "enter: copy & exit • ctrl+e/z: run • ctrl+o: newline • esc: back" {
+		t.Errorf("unexpected edit help %q", status)
+	}
+	edit, _ = edit.(model).handleEditKeys(tea.KeyMsg{Type: tea.KeyCtrlO})
+	edit, _ = edit.(model).handleEditKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	if got := edit.(model).editInput.Value(); got != "ls\nz" {
+		t.Errorf("expected ctrl+o to add a line and z to be typed, got %q", got)
+	}
+	edit, _ = edit.(model).handleEditKeys(tea.KeyMsg{Type: tea.KeyCtrlJ})
+	if got := edit.(model).editInput.Value(); got != "ls\nz" {
+		t.Errorf("expected ctrl+j to no longer add a line, got %q", got)
+	}
+
+	next, _ = m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyF1})
+	if next.(model).mode != modeHelp {
+		t.Fatalf("expected f1 to open the help overlay")
+	}
+	next, _ = next.(model).handleKeyMsg(tea.KeyMsg{Type: tea.KeyEsc})
+	if next.(model).mode != modeViewing {
+		t.Errorf("expected esc to close the help overlay")
+	}
+}
@@ -0,0 +1,367 @@
+package instassist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+)
+
+// modesDirName is the directory in the config dir holding user modes, one
+// <name>.toml file each.
+const modesDirName = "modes"
+
+// promptMode is a named prompt template: a preamble for a kind of task, the
+// provider it works best with and extra fields each option should carry.
+// User modes are TOML files with the same keys:
+//
+//	description = "Terraform commands"
+//	cli = "claude"
+//	preamble = "Give me terraform commands for a {{.OS}} machine, run from {{.Cwd}}: "
+//	[[fields]]
+//	name = "workspace"
+//	description = "terraform workspace the command applies to"
+type promptMode struct {
+	Name        string      `toml:"-"`
+	Description string      `toml:"description"`
+	CLI         string      `toml:"cli"`
+	Preamble    string      `toml:"preamble"`
+	Fields      []modeField `toml:"fields"`
+}
+
+// modeField is an extra per-option field a mode asks for, added to the
+// schema under "fields" and shown in the detail pane.
+type modeField struct {
+	Name        string `toml:"name"`
+	Description string `toml:"description"`
+}
+
+// modeTemplateData is what mode preambles can reference, e.g. {{.Cwd}}.
+type modeTemplateData struct {
+	Mode      string
+	OS        string
+	Distro    string
+	Shell     string
+	Cwd       string
+	GitRepo   bool
+	GitBranch string
+	Tools     []string
+}
+
+func newModeTemplateData(mode string, env envInfo) modeTemplateData {
+	return modeTemplateData{
+		Mode:      mode,
+		OS:        env.os,
+		Distro:    env.distro,
+		Shell:     env.shell,
+		Cwd:       env.cwd,
+		GitRepo:   env.gitRepo,
+		GitBranch: env.gitBranch,
+		Tools:     env.tools,
+	}
+}
+
+var modeFieldName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func builtinModes() []promptMode {
+	return []promptMode{
+		{
+			Name:        "git",
+			Description: "git commands for the current repository",
+			Preamble:    "Give me one or more git commands with short descriptions for the following, run from {{.Cwd}}{{if .GitBranch}} on branch {{.GitBranch}}{{end}}. Prefer porcelain commands and say in the description when a command rewrites history or needs a force push: ",
+		},
+		{
+			Name:        "kubectl",
+			Description: "kubectl commands against the current context",
+			Preamble:    "Give me one or more kubectl commands with short descriptions for the following, for the cluster and namespace of the current kubectl context unless the request names others. Prefer read-only commands when the request allows it: ",
+			Fields: []modeField{
+				{Name: "resources", Description: "Kubernetes resource kinds the command reads or changes, e.g. pods, deployments"},
+			},
+		},
+		{
+			Name:        "sql",
+			Description: "SQL queries",
+			Preamble:    "Give me one or more SQL queries as the option values, with short descriptions, for the following. Use portable SQL unless the request names a database: ",
+			Fields: []modeField{
+				{Name: "dialect", Description: "SQL dialect the query is written for, e.g. PostgreSQL, MySQL or SQLite"},
+			},
+		},
+		{
+			Name:        "ffmpeg",
+			Description: "ffmpeg commands for audio and video",
+			Preamble:    "Give me one or more ffmpeg commands for {{.Shell}} with short descriptions for the following. Keep the input file names the request gives and name outputs after them: ",
+			Fields: []modeField{
+				{Name: "output_format", Description: "container and codecs of the output, e.g. mp4 (h264/aac)"},
+			},
+		},
+		{
+			Name:        "regex",
+			Description: "regular expressions",
+			Preamble:    "Give me one or more regular expressions as the option values, without delimiters or quoting, with short descriptions, for the following: ",
+			Fields: []modeField{
+				{Name: "flavor", Description: "regex flavor the pattern is written for, e.g. PCRE, POSIX ERE, JavaScript or Go RE2"},
+				{Name: "example", Description: "a short string the pattern matches"},
+			},
+		},
+	}
+}
+
+// validate checks a mode's fields and that its preamble is a template that
+// renders.
+func (pm promptMode) validate() error {
+	if strings.TrimSpace(pm.Preamble) == "" {
+		return fmt.Errorf("preamble is required")
+	}
+	if _, err := pm.render(modeTemplateData{}); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, f := range pm.Fields {
+		if !modeFieldName.MatchString(f.Name) {
+			return fmt.Errorf("field name %q must be lowercase letters, digits and underscores", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("field %q is declared twice", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	return nil
+}
+
+// render executes the preamble template with data.
+func (pm promptMode) render(data modeTemplateData) (string, error) {
+	tmpl, err := template.New(pm.Name).Option("missingkey=error").Parse(pm.Preamble)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// preamble renders the mode's preamble for env. Modes are validated when
+// loaded, so a failure here falls back to the raw text.
+func (pm promptMode) preamble(env envInfo) string {
+	text, err := pm.render(newModeTemplateData(pm.Name, env))
+	if err != nil {
+		return pm.Preamble
+	}
+	return text
+}
+
+// loadModes returns the built-in modes with the user's mode files from dir
+// applied. A file replaces the built-in mode of the same name; other modes
+// are appended in name order. A missing directory is not an error.
+func loadModes(dir string) ([]promptMode, error) {
+	modes := builtinModes()
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return modes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".toml") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		path := filepath.Join(dir, file)
+		pm := promptMode{Name: strings.ToLower(strings.TrimSuffix(file, ".toml"))}
+		if _, err := toml.DecodeFile(path, &pm); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := pm.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		replaced := false
+		for i := range modes {
+			if modes[i].Name == pm.Name {
+				modes[i] = pm
+				replaced = true
+			}
+		}
+		if !replaced {
+			modes = append(modes, pm)
+		}
+	}
+	return modes, nil
+}
+
+func lookupMode(modes []promptMode, name string) (promptMode, bool) {
+	for _, pm := range modes {
+		if strings.EqualFold(pm.Name, name) {
+			return pm, true
+		}
+	}
+	return promptMode{}, false
+}
+
+func modeNames(modes []promptMode) []string {
+	names := make([]string, len(modes))
+	for i, pm := range modes {
+		names[i] = pm.Name
+	}
+	return names
+}
+
+// fieldsInstruction asks for a mode's extra fields in the prompt, for
+// providers that do not enforce the schema.
+func fieldsInstruction(fields []modeField) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = fmt.Sprintf("%q (%s)", f.Name, f.Description)
+	}
+	return `Each option must also include "fields", an object with ` + strings.Join(parts, ", ") + "."
+}
+
+// withFields returns the options schema with a required "fields" object
+// holding the extra fields. Without fields the schema is returned as is.
+func (s schemaSpec) withFields(name string, fields []modeField) (schemaSpec, error) {
+	if len(fields) == 0 {
+		return s, nil
+	}
+	var root map[string]any
+	if err := json.Unmarshal([]byte(s.json), &root); err != nil {
+		return s, fmt.Errorf("options schema: %w", err)
+	}
+	props, _ := root["properties"].(map[string]any)
+	options, _ := props["options"].(map[string]any)
+	items, _ := options["items"].(map[string]any)
+	itemProps, _ := items["properties"].(map[string]any)
+	if itemProps == nil {
+		return s, fmt.Errorf("options schema has no option properties")
+	}
+	fieldProps := map[string]any{}
+	required := make([]any, len(fields))
+	for i, f := range fields {
+		fieldProps[f.Name] = map[string]any{"type": []string{"string", "null"}, "description": f.Description}
+		required[i] = f.Name
+	}
+	itemProps["fields"] = map[string]any{
+		"type":                 "object",
+		"properties":           fieldProps,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	if req, ok := items["required"].([]any); ok {
+		items["required"] = append(req, "fields")
+	}
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return s, err
+	}
+
+	// CLIs like codex read the schema from a file. It is named after its
+	// contents, so every run and mode switch reuses the same file instead
+	// of leaving a new one behind.
+	sum := sha256.Sum256(data)
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("insta-options-schema-%s-%x.json", name, sum[:8]))
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return schemaSpec{path: path, json: string(data)}, nil
+	}
+	tmp, err := os.CreateTemp("", "insta-options-schema-"+name+"-*.json")
+	if err != nil {
+		return s, fmt.Errorf("failed to create temp schema file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return s, fmt.Errorf("failed to write temp schema file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return s, fmt.Errorf("failed to close temp schema file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return s, fmt.Errorf("failed to write temp schema file: %w", err)
+	}
+	return schemaSpec{path: path, json: string(data)}, nil
+}
+
+// currentMode returns the prompt mode new prompts use.
+func (m model) currentMode() (promptMode, bool) {
+	if m.modeIndex < 0 || m.modeIndex >= len(m.cfg.modes) {
+		return promptMode{}, false
+	}
+	return m.cfg.modes[m.modeIndex], true
+}
+
+// preamble is the mode's rendered preamble, or the configured one.
+func (m model) preamble() string {
+	if pm, ok := m.currentMode(); ok {
+		return pm.preamble(m.env)
+	}
+	return m.cfg.preamble
+}
+
+func (m model) modeFields() []modeField {
+	pm, _ := m.currentMode()
+	return pm.Fields
+}
+
+// selectMode switches new prompts to the mode at index (-1 for none) and
+// its schema. switchCLI also moves to the mode's provider, when available;
+// at startup the provider was already resolved with -cli in mind.
+func (m *model) selectMode(index int, switchCLI bool) {
+	m.modeIndex = index
+	m.schema = m.baseSchema
+	pm, ok := m.currentMode()
+	if !ok {
+		return
+	}
+	if len(pm.Fields) > 0 {
+		if spec, cached := m.modeSchemas[pm.Name]; cached {
+			m.schema = spec
+		} else if spec, err := m.baseSchema.withFields(pm.Name, pm.Fields); err == nil {
+			m.modeSchemas[pm.Name] = spec
+			m.schema = spec
+		} else {
+			m.status = fmt.Sprintf("mode %s: %v • %s", pm.Name, err, m.helpInput())
+		}
+	}
+	if switchCLI && pm.CLI != "" {
+		for i, p := range m.providers {
+			if strings.EqualFold(p.name(), pm.CLI) {
+				m.cliIndex = i
+			}
+		}
+	}
+}
+
+// cycleMode moves to the next mode, wrapping around through no mode.
+func (m *model) cycleMode() {
+	next := m.modeIndex + 1
+	if next >= len(m.cfg.modes) {
+		next = -1
+	}
+	m.status = m.helpInput()
+	m.selectMode(next, true)
+}
+
+// modeLabel is the header pill text for the current mode.
+func (m model) modeLabel() string {
+	if pm, ok := m.currentMode(); ok {
+		return "mode: " + pm.Name
+	}
+	return "mode: default"
+}
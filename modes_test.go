@@ -0,0 +1,201 @@
+package instassist
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadModesAppliesUserFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"git.toml":       `preamble = "Only plumbing commands, from {{.Cwd}}: "`,
+		"terraform.toml": "cli = \"claude\"\npreamble = \"Terraform for {{.OS}}: \"\n[[fields]]\nname = \"workspace\"\ndescription = \"target workspace\"\n",
+		"notes.txt":      "ignored",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modes, err := loadModes(dir)
+	if err != nil {
+		t.Fatalf("loadModes: %v", err)
+	}
+	if len(modes) != len(builtinModes())+1 {
+		t.Fatalf("expected the built-ins plus terraform, got %v", modeNames(modes))
+	}
+	git, _ := lookupMode(modes, "git")
+	if got := git.preamble(envInfo{cwd: "/src"}); got != "Only plumbing commands, from /src: " {
+		t.Errorf("expected the user git mode to replace the built-in one, got %q", got)
+	}
+	tf, ok := lookupMode(modes, "Terraform")
+	if !ok || tf.CLI != "claude" || len(tf.Fields) != 1 || tf.Fields[0].Name != "workspace" {
+		t.Errorf("unexpected terraform mode %+v", tf)
+	}
+}
+
+func TestLoadModesRejectsInvalidFiles(t *testing.T) {
+	for _, data := range []string{
+		`preamble = "Commands for {{.Kernel}}: "`,
+		`preamble = "Commands for {{.OS: "`,
+		`description = "no preamble"`,
+		"preamble = \"x\"\n[[fields]]\nname = \"Bad Name\"\n",
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "bad.toml"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadModes(dir); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestBuiltinModesRender(t *testing.T) {
+	env := envInfo{os: "linux", shell: "zsh", cwd: "/src", gitRepo: true, gitBranch: "main"}
+	for _, pm := range builtinModes() {
+		if err := pm.validate(); err != nil {
+			t.Errorf("mode %s: %v", pm.Name, err)
+		}
+		if got := pm.preamble(env); strings.Contains(got, "{{") {
+			t.Errorf("mode %s left template actions in %q", pm.Name, got)
+		}
+	}
+}
+
+func TestSchemaWithFields(t *testing.T) {
+	base := schemaSpec{path: "options.schema.json", json: string(embeddedSchema)}
+	spec, err := base.withFields("sql", []modeField{{Name: "dialect", Description: "SQL dialect"}})
+	if err != nil {
+		t.Fatalf("withFields: %v", err)
+	}
+	defer os.Remove(spec.path)
+	if data, err := os.ReadFile(spec.path); err != nil || string(data) != spec.json {
+		t.Fatalf("expected the schema file to hold the extended schema: %v", err)
+	}
+
+	var root struct {
+		Properties struct {
+			Options struct {
+				Items struct {
+					Properties map[string]json.RawMessage `json:"properties"`
+					Required   []string                   `json:"required"`
+				} `json:"items"`
+			} `json:"options"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(spec.json), &root); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	items := root.Properties.Options.Items
+	if _, ok := items.Properties["fields"]; !ok || !strings.Contains(string(items.Properties["fields"]), "dialect") {
+		t.Errorf("expected a fields property with dialect, got %s", items.Properties["fields"])
+	}
+	if items.Required[len(items.Required)-1] != "fields" {
+		t.Errorf("expected fields to be required, got %v", items.Required)
+	}
+
+	if same, _ := base.withFields("git", nil); same != base {
+		t.Errorf("expected a mode without fields to keep the schema")
+	}
+}
+
+func TestSchemaWithFieldsReusesItsFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	base := schemaSpec{path: "options.schema.json", json: string(embeddedSchema)}
+	fields := []modeField{{Name: "dialect", Description: "SQL dialect"}}
+	first, err := base.withFields("sql", fields)
+	if err != nil {
+		t.Fatalf("withFields: %v", err)
+	}
+	second, err := base.withFields("sql", fields)
+	if err != nil || second.path != first.path {
+		t.Fatalf("expected the same schema file, got %s and %s (%v)", first.path, second.path, err)
+	}
+	other, _ := base.withFields("sql", []modeField{{Name: "engine", Description: "database engine"}})
+	if other.path == first.path {
+		t.Errorf("expected different fields to get their own file")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected one file per schema, got %d", len(entries))
+	}
+}
+
+func TestModeFlagSelectsModeAndProvider(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.modes = append(cfg.modes, promptMode{Name: "tf", CLI: "claude", Preamble: "Terraform: "})
+	fs := flag.NewFlagSet("inst", flag.ContinueOnError)
+	flags := registerFlags(fs)
+	if err := fs.Parse([]string{"-mode", "TF"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.applyFlags(fs, flags); err != nil {
+		t.Fatalf("applyFlags: %v", err)
+	}
+	if cfg.mode != "tf" || cfg.defaultCLI != "claude" || cfg.sources["default_cli"] != "mode tf" {
+		t.Errorf("expected mode tf with its provider, got mode %q cli %q (%s)", cfg.mode, cfg.defaultCLI, cfg.sources["default_cli"])
+	}
+
+	cfg = defaultConfig()
+	cfg.modes = append(cfg.modes, promptMode{Name: "tf", CLI: "claude", Preamble: "Terraform: "})
+	fs = flag.NewFlagSet("inst", flag.ContinueOnError)
+	flags = registerFlags(fs)
+	fs.Parse([]string{"-mode", "tf", "-cli", "gemini"})
+	if err := cfg.applyFlags(fs, flags); err != nil || cfg.defaultCLI != "gemini" {
+		t.Errorf("expected -cli to win over the mode's provider, got %q, %v", cfg.defaultCLI, err)
+	}
+
+	fs = flag.NewFlagSet("inst", flag.ContinueOnError)
+	flags = registerFlags(fs)
+	fs.Parse([]string{"-mode", "nosuch"})
+	if err := cfg.applyFlags(fs, flags); err == nil {
+		t.Errorf("expected an unknown mode to be rejected")
+	}
+}
+
+func TestBuildPromptAsksForModeFields(t *testing.T) {
+	prompt := buildPrompt("SQL for: ", "", "top customers", modeField{Name: "dialect", Description: "SQL dialect"})
+	if !strings.Contains(prompt, `"fields"`) || !strings.Contains(prompt, `"dialect" (SQL dialect)`) {
+		t.Errorf("expected the fields instruction, got %q", prompt)
+	}
+	if strings.Contains(buildPrompt("", "", "list files"), `"fields"`) {
+		t.Errorf("expected no fields instruction without a mode")
+	}
+
+	opts, err := parseOptions(`{"options":[{"value":"SELECT 1","description":"d","recommendation_order":1,"fields":{"dialect":"SQLite","rows":3,"note":null}}]}`)
+	if err != nil || len(opts) != 1 {
+		t.Fatalf("parseOptions: %v", err)
+	}
+	if f := opts[0].Fields; f["dialect"] != "SQLite" || f["rows"] != "3" || len(f) != 2 {
+		t.Errorf("unexpected fields %v", f)
+	}
+}
+
+func TestModeProviderOnlyFollowsModeSwitches(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.modes = []promptMode{{Name: "tf", CLI: "claude"}}
+	m := model{
+		cfg:       cfg,
+		keys:      defaultKeyMap(),
+		providers: []provider{cliProvider{id: "codex"}, cliProvider{id: "claude"}},
+		modeIndex: -1,
+	}
+
+	// At startup -cli codex has already won over the mode's provider.
+	m.selectMode(0, false)
+	if m.modeIndex != 0 || m.cliIndex != 0 {
+		t.Errorf("expected mode tf on codex, got mode %d cli %d", m.modeIndex, m.cliIndex)
+	}
+
+	m.modeIndex = -1
+	m.cycleMode()
+	if m.modeIndex != 0 || m.cliIndex != 1 {
+		t.Errorf("expected switching to mode tf to pick claude, got mode %d cli %d", m.modeIndex, m.cliIndex)
+	}
+}
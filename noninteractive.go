@@ -2,6 +2,8 @@ package instassist
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,87 +14,310 @@ import (
 	"github.com/atotto/clipboard"
 )
 
-func runNonInteractive(cliName, userPrompt string, selectIndex int, outputMode string, yolo bool) {
-	schemaPath, schemaJSON, err := schemaSources()
+// Exit codes for non-interactive failures that scripts may want to tell
+// apart. Everything else exits with 1; 2 is left to flag parsing errors.
+const (
+	exitCLIMissing    = 3
+	exitProviderError = 4
+	exitParseError    = 5
+	exitNoOptions     = 6
+)
+
+// exitKinds names the exit codes in JSON error output.
+var exitKinds = map[int]string{
+	1:                 "error",
+	exitCLIMissing:    "cli_missing",
+	exitProviderError: "provider_error",
+	exitParseError:    "parse_error",
+	exitNoOptions:     "no_options",
+}
+
+// runError is a non-interactive failure and the exit code it maps to.
+type runError struct {
+	code int
+	err  error
+}
+
+func (e *runError) Error() string {
+	return e.err.Error()
+}
+
+// jsonResult is what -output json prints: every option, plus where and how
+// fast they came.
+type jsonResult struct {
+	Provider   string        `json:"provider"`
+	SessionID  string        `json:"session_id,omitempty"`
+	DurationMS int64         `json:"duration_ms"`
+	Cached     bool          `json:"cached,omitempty"`
+	Options    []optionEntry `json:"options"`
+}
+
+// jsonlOption is one line of -output jsonl.
+type jsonlOption struct {
+	Provider   string `json:"provider"`
+	SessionID  string `json:"session_id,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Cached     bool   `json:"cached,omitempty"`
+	Index      int    `json:"index"`
+	optionEntry
+}
+
+// jsonError is printed on stdout in json and jsonl mode before exiting with
+// a failure.
+type jsonError struct {
+	Error    string `json:"error"`
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// queryProvider sends req to p and parses the options, classifying failures
+// by exit code.
+func queryProvider(ctx context.Context, p provider, req providerRequest, sessionID string) ([]optionEntry, string, error) {
+	output, err := sendPrompt(ctx, p, req, sessionID)
 	if err != nil {
-		log.Fatalf("schema not found: %v", err)
-	}
-
-	fullPrompt := buildPrompt(userPrompt)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	var output []byte
-	switch strings.ToLower(cliName) {
-	case "codex":
-		args := []string{"exec", "--output-schema", schemaPath, "--skip-git-repo-check", "--json"}
-		if yolo {
-			args = append(args, "--yolo")
-		}
-		cmd := exec.CommandContext(ctx, "codex", args...)
-		cmd.Stdin = strings.NewReader(fullPrompt)
-		output, err = cmd.CombinedOutput()
-	case "claude":
-		args := []string{"-p", fullPrompt, "--print", "--output-format", "json", "--json-schema", schemaJSON}
-		if yolo {
-			args = append(args, "--dangerously-skip-permissions")
-		}
-		cmd := exec.CommandContext(ctx, "claude", args...)
-		output, err = cmd.CombinedOutput()
-	case "gemini":
-		args := []string{"--output-format", "json"}
-		if yolo {
-			args = append(args, "--yolo")
-		}
-		args = append(args, fullPrompt)
-		cmd := exec.CommandContext(ctx, "gemini", args...)
-		output, err = cmd.CombinedOutput()
-	case "opencode":
-		cmd := exec.CommandContext(ctx, "opencode", "run", "--format", "json", fullPrompt)
-		output, err = cmd.CombinedOutput()
-	default:
-		log.Fatalf("unknown CLI: %s (supported: codex, claude, gemini, opencode)", cliName)
+		return nil, "", &runError{exitProviderError, fmt.Errorf("CLI error: %v\nOutput: %s", err, output)}
 	}
+	opts, err := extractOptions(string(output))
+	if errors.Is(err, errNoOptions) {
+		return nil, "", &runError{exitNoOptions, err}
+	}
+	if err != nil {
+		return nil, "", &runError{exitParseError, fmt.Errorf("parse error: %v\nRaw output: %s", err, output)}
+	}
+	return opts, sessionIDFor(p, string(output)), nil
+}
+
+// exitWithError reports err and exits with its code, also as a JSON object
+// on stdout when the caller expects JSON.
+func exitWithError(err error, jsonOutput bool) {
+	code := 1
+	var re *runError
+	if errors.As(err, &re) {
+		code = re.code
+	}
+	if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(jsonError{Error: err.Error(), Kind: exitKinds[code], ExitCode: code})
+	}
+	log.Print(err)
+	os.Exit(code)
+}
 
+func runNonInteractive(providers []provider, cfg config, userPrompt string, flags *cliFlags) {
+	fail := func(err error) {
+		exitWithError(err, cfg.output == "json" || cfg.output == "jsonl")
+	}
+
+	schemaPath, schemaJSON, err := schemaSources()
 	if err != nil {
-		log.Fatalf("CLI error: %v\nOutput: %s", err, string(output))
+		fail(fmt.Errorf("schema not found: %v", err))
+	}
+
+	// -session names a stored session, whose provider is used unless -cli
+	// picks another, or passes a raw provider session ID through.
+	resumeID := flags.session
+	var priorPrompts []string
+	if flags.session != "" {
+		records, _ := loadSessions()
+		rec, err := lookupSession(records, flags.session)
+		switch {
+		case err == nil:
+			resumeID, priorPrompts = rec.ID, rec.Prompts
+			if cfg.sources["default_cli"] != "flag -cli" {
+				cfg.defaultCLI = rec.Provider
+			}
+		case flags.session == "last":
+			fail(err)
+		}
 	}
 
-	opts, parseErr := extractOptions(string(output))
-	if parseErr != nil {
-		log.Fatalf("parse error: %v\nRaw output: %s", parseErr, string(output))
+	p, ok := lookupProvider(providers, cfg.defaultCLI)
+	if !ok {
+		fail(&runError{exitCLIMissing, fmt.Errorf("unknown CLI: %s (supported: %s)", cfg.defaultCLI, strings.Join(providerNames(providers), ", "))})
+	}
+	if !p.available() {
+		fail(&runError{exitCLIMissing, fmt.Errorf("provider not available: %s (CLI not in PATH or API not configured)", p.name())})
 	}
 
-	if len(opts) == 0 {
-		log.Fatalf("no options returned")
+	envBlock := ""
+	if cfg.context {
+		envBlock = gatherEnv().block()
 	}
+	schema := schemaSpec{path: schemaPath, json: schemaJSON}
 
-	var selectedValue string
-	if selectIndex >= 0 && selectIndex < len(opts) {
-		selectedValue = opts[selectIndex].Value
+	// A prompt mode replaces the preamble and asks for its extra fields.
+	preamble := cfg.preamble
+	var fields []modeField
+	if pm, ok := cfg.currentMode(); ok {
+		preamble, fields = pm.preamble(gatherEnv()), pm.Fields
+		if schema, err = schema.withFields(pm.Name, pm.Fields); err != nil {
+			fail(err)
+		}
+	}
+
+	// ask sends prompt (resuming sessionID when set) and returns the options
+	// and the session to resume next.
+	ask := func(prompt, sessionID string) ([]optionEntry, string) {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		defer cancel()
+
+		req := providerRequest{prompt: prompt, yolo: cfg.yolo, schema: schema}
+		opts, next, err := queryProvider(ctx, p, req, sessionID)
+		if err != nil {
+			fail(err)
+		}
+		if next != "" {
+			sessionID = next
+		}
+		return opts, sessionID
+	}
+
+	// askAll sends prompt to every -cli provider at once and merges their
+	// options. Providers that fail are reported and left out.
+	askAll := func(prompt string) ([]optionEntry, string) {
+		providers, err := resolveProviders(providers, cfg.compareCLIs)
+		if err != nil {
+			fail(&runError{exitCLIMissing, err})
+		}
+		for _, cp := range providers {
+			if !cp.available() {
+				fail(&runError{exitCLIMissing, fmt.Errorf("provider not available: %s (CLI not in PATH or API not configured)", cp.name())})
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		defer cancel()
+
+		req := providerRequest{prompt: prompt, yolo: cfg.yolo, schema: schema}
+		results := runCompare(ctx, providers, req)
+		sessionID := ""
+		var ok []providerResult
+		var firstErr error
+		for _, r := range results {
+			if r.err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", r.provider, r.err)
+				if firstErr == nil {
+					firstErr = r.err
+				}
+				continue
+			}
+			ok = append(ok, r)
+			if r.provider == p.name() {
+				sessionID = r.sessionID
+			}
+		}
+		if len(ok) == 0 {
+			fail(firstErr)
+		}
+		return mergeOptions(ok), sessionID
+	}
+
+	start := time.Now()
+	providerLabel := p.name()
+	var opts []optionEntry
+	var sessionID string
+	cached := false
+	if len(cfg.compareCLIs) > 1 {
+		if flags.session != "" {
+			fail(fmt.Errorf("-session resumes a single provider and cannot be used with several -cli providers"))
+		}
+		providerLabel = strings.Join(cfg.compareCLIs, ",")
+		opts, sessionID = askAll(buildPrompt(preamble, envBlock, userPrompt, fields...))
+	} else if resumeID == "" && cfg.cacheTTL > 0 {
+		// New prompts are answered from the response cache the TUI shares.
+		key := cacheKey(p.name(), userPrompt, preamble, envBlock, schema.json)
+		entry, hit := cacheEntry{}, false
+		if !cfg.noCache {
+			entry, hit = loadCached(key, cfg.cacheTTL)
+		}
+		if hit {
+			opts, sessionID, cached = entry.Options, entry.SessionID, true
+		} else {
+			opts, sessionID = ask(buildPrompt(preamble, envBlock, userPrompt, fields...), "")
+			_ = storeCached(key, cacheEntry{Provider: p.name(), Prompt: userPrompt, SessionID: sessionID, Options: opts, Time: time.Now()}, cfg.cacheMaxEntries)
+		}
 	} else {
-		selectedValue = opts[0].Value
+		opts, sessionID = ask(buildPrompt(preamble, envBlock, userPrompt, fields...), resumeID)
+	}
+	elapsed := time.Since(start).Milliseconds()
+	if sessionID != "" && !cached {
+		// Saved for -session last and inst sessions; best-effort like the
+		// TUI's history.
+		cwd, _ := os.Getwd()
+		_ = saveSession(sessionRecord{ID: sessionID, Provider: p.name(), Prompts: append(priorPrompts, userPrompt), Options: opts, Cwd: cwd, Time: time.Now()})
+	}
+
+	if len(opts) == 0 {
+		fail(&runError{exitNoOptions, errNoOptions})
+	}
+	selected := opts[0]
+	if flags.selectIndex >= 0 && flags.selectIndex < len(opts) {
+		selected = opts[flags.selectIndex]
 	}
 
-	switch strings.ToLower(outputMode) {
+	switch cfg.output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(jsonResult{Provider: providerLabel, SessionID: sessionID, DurationMS: elapsed, Cached: cached, Options: opts})
+	case "jsonl":
+		enc := json.NewEncoder(os.Stdout)
+		for i, opt := range opts {
+			enc.Encode(jsonlOption{Provider: providerLabel, SessionID: sessionID, DurationMS: elapsed, Cached: cached, Index: i, optionEntry: opt})
+		}
 	case "stdout":
-		fmt.Println(selectedValue)
+		fmt.Println(resolveSelected(selected, flags.params))
 	case "exec":
-		cmd := exec.Command("sh", "-c", selectedValue)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		if err := cmd.Run(); err != nil {
-			log.Fatalf("exec error: %v", err)
+		for attempt := 0; ; attempt++ {
+			selectedValue := resolveSelected(selected, flags.params)
+			if r := analyzeRisk(selectedValue).withDeclared(selected.Risk); r.level == riskDestructive && !cfg.allowDangerous {
+				log.Fatalf("refusing to run destructive command: %s\nReasons: %s\nPass -allow-dangerous to run it anyway", selectedValue, strings.Join(r.reasons, "; "))
+			}
+			failure := runCaptured(selectedValue)
+			if failure == nil {
+				return
+			}
+			if attempt >= flags.retryOnFailure {
+				log.Fatalf("exec error: %v", failure.err)
+			}
+
+			fmt.Fprintf(os.Stderr, "command failed (exit %d), asking %s for a fix (attempt %d of %d)\n", failure.exitCode, p.name(), attempt+1, flags.retryOnFailure)
+			if sessionID != "" && p.caps().resume {
+				opts, sessionID = ask(buildPrompt(preamble, "", fixPrompt(*failure, ""), fields...), sessionID)
+			} else {
+				opts, sessionID = ask(buildPrompt(preamble, envBlock, fixPrompt(*failure, userPrompt), fields...), "")
+			}
+			if len(opts) == 0 {
+				fail(&runError{exitNoOptions, errNoOptions})
+			}
+			selected = opts[0]
 		}
 	case "clipboard":
+		selectedValue := resolveSelected(selected, flags.params)
 		if err := clipboard.WriteAll(selectedValue); err != nil {
 			log.Fatalf("clipboard error: %v\nHint: On Linux, install xclip or xsel (e.g., 'sudo pacman -S xclip')", err)
 		}
-		fmt.Printf("✅ Copied to clipboard: %s\n", selectedValue)
+		fmt.Printf("%s Copied to clipboard: %s\n", cfg.glyphSet().ok, selectedValue)
 	default:
-		log.Fatalf("unknown output mode: %s", outputMode)
+		fd, ok := parseFDOutput(cfg.output)
+		if !ok {
+			fail(fmt.Errorf("unknown output mode: %s", cfg.output))
+		}
+		if err := writeToFD(fd, resolveSelected(selected, flags.params)); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// resolveSelected fills the option's parameters and warns about required
+// binaries that are missing.
+func resolveSelected(opt optionEntry, params paramValues) string {
+	value, err := resolveParameters(opt, params)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if missing := missingRequirements(opt, cliAvailable); len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: not found in PATH: %s\n", strings.Join(missing, ", "))
 	}
+	return value
 }
 
 func cliAvailable(name string) bool {
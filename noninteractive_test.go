@@ -0,0 +1,65 @@
+package instassist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubProvider returns canned output for non-interactive tests.
+type stubProvider struct {
+	out string
+	err error
+}
+
+func (s stubProvider) name() string       { return "stub" }
+func (s stubProvider) available() bool    { return true }
+func (s stubProvider) caps() providerCaps { return providerCaps{} }
+func (s stubProvider) run(ctx context.Context, req providerRequest) ([]byte, error) {
+	return []byte(s.out), s.err
+}
+func (s stubProvider) resume(ctx context.Context, req providerRequest, sessionID string) ([]byte, error) {
+	return s.run(ctx, req)
+}
+
+func TestQueryProviderExitCodes(t *testing.T) {
+	cases := []struct {
+		p    stubProvider
+		code int
+	}{
+		{stubProvider{out: "boom", err: errors.New("exit status 1")}, exitProviderError},
+		{stubProvider{out: "I could not help with that"}, exitParseError},
+		{stubProvider{out: `{"options": []}`}, exitNoOptions},
+		{stubProvider{out: `{"type":"result","result":"{\"options\":[]}"}`}, exitNoOptions},
+		// An empty array that is only mentioned, not returned, is a parse error.
+		{stubProvider{out: `Reply with "options": [] when nothing fits`}, exitParseError},
+		{stubProvider{out: `{"type":"user","text":"say \"options\": [] if unsure"}`}, exitParseError},
+	}
+	for _, tc := range cases {
+		_, _, err := queryProvider(context.Background(), tc.p, providerRequest{}, "")
+		var re *runError
+		if !errors.As(err, &re) || re.code != tc.code {
+			t.Errorf("queryProvider(%q) = %v, want exit code %d", tc.p.out, err, tc.code)
+		}
+	}
+
+	opts, sessionID, err := queryProvider(context.Background(), stubProvider{
+		out: `{"session_id":"0b7c8a52-5d3e-4f4a-9a8e-2f1d6c3b9e10","options":[{"value":"ls","description":"list"}]}`,
+	}, providerRequest{}, "")
+	if err != nil || len(opts) != 1 || sessionID != "0b7c8a52-5d3e-4f4a-9a8e-2f1d6c3b9e10" {
+		t.Fatalf("queryProvider = %v, %q, %v", opts, sessionID, err)
+	}
+}
+
+func TestJSONLOptionFlattensOption(t *testing.T) {
+	line, err := json.Marshal(jsonlOption{Provider: "codex", DurationMS: 1200, Index: 0, optionEntry: optionEntry{Value: "ls", Description: "list", RecommendationOrder: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"provider":"codex","duration_ms":1200,"index":0,"value":"ls","description":"list","recommendation_order":1}`
+	if got := strings.TrimSpace(string(line)); got != want {
+		t.Fatalf("jsonl line = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,299 @@
+package instassist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const helpParams = "tab/shift+tab: next/prev field • enter: confirm • esc: back"
+
+// placeholderPattern matches {{name}} references in an option value.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// optionParam is a named placeholder the model declared for an option.
+type optionParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// paramValues collects repeated -param name=value flags.
+type paramValues map[string]string
+
+func (p paramValues) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + p[name]
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p paramValues) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	p[name] = value
+	return nil
+}
+
+// optionParameters returns the parameters an option uses: the declared ones
+// that appear in its value, followed by any undeclared {{name}} references.
+func optionParameters(opt optionEntry) []optionParam {
+	used := map[string]bool{}
+	var order []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(opt.Value, -1) {
+		if !used[match[1]] {
+			used[match[1]] = true
+			order = append(order, match[1])
+		}
+	}
+	var params []optionParam
+	for _, p := range opt.Parameters {
+		if used[p.Name] {
+			params = append(params, p)
+			delete(used, p.Name)
+		}
+	}
+	for _, name := range order {
+		if used[name] {
+			params = append(params, optionParam{Name: name})
+		}
+	}
+	return params
+}
+
+// fillParameters substitutes {{name}} references in value, quoting each
+// replacement for the shell context it appears in: bare words are
+// single-quoted when needed, and text already inside single or double
+// quotes is escaped for that quote style.
+func fillParameters(value string, values map[string]string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(value, -1) {
+		name := value[loc[2]:loc[3]]
+		replacement, ok := values[name]
+		if !ok {
+			continue
+		}
+		b.WriteString(value[last:loc[0]])
+		switch quoteContext(value[:loc[0]]) {
+		case '\'':
+			b.WriteString(strings.ReplaceAll(replacement, "'", `'\''`))
+		case '"':
+			b.WriteString(escapeDoubleQuoted(replacement))
+		default:
+			b.WriteString(shellQuote(replacement))
+		}
+		last = loc[1]
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// quoteContext reports the quote character that is open at the end of
+// prefix, or 0 when it ends outside quotes.
+func quoteContext(prefix string) byte {
+	var open byte
+	escaped := false
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		switch {
+		case escaped:
+			escaped = false
+		case open == '\'':
+			if c == '\'' {
+				open = 0
+			}
+		case c == '\\':
+			escaped = true
+		case open == '"':
+			if c == '"' {
+				open = 0
+			}
+		case c == '\'' || c == '"':
+			open = c
+		}
+	}
+	return open
+}
+
+func escapeDoubleQuoted(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '"' || r == '\\' || r == '$' || r == '`' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// shellQuote returns s as a single shell word.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,@%+", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// resolveParameters fills opt's parameters from values, falling back to
+// declared defaults, and reports parameters that have neither.
+func resolveParameters(opt optionEntry, values map[string]string) (string, error) {
+	params := optionParameters(opt)
+	filled := map[string]string{}
+	var missing []string
+	for _, p := range params {
+		if v, ok := values[p.Name]; ok {
+			filled[p.Name] = v
+		} else if p.Default != "" {
+			filled[p.Name] = p.Default
+		} else {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing value for parameter %s (pass -param %s=value)", strings.Join(missing, ", "), missing[0])
+	}
+	return fillParameters(opt.Value, filled), nil
+}
+
+// openParamForm shows one input per parameter of opt; action says whether
+// the filled command is copied or run once the form is confirmed.
+func (m model) openParamForm(opt optionEntry, action string) (tea.Model, tea.Cmd) {
+	params := optionParameters(opt)
+	inputs := make([]textinput.Model, len(params))
+	for i, p := range params {
+		in := textinput.New()
+		in.Prompt = p.Name + ": "
+		in.Placeholder = p.Description
+		in.SetValue(p.Default)
+		in.CursorEnd()
+		inputs[i] = in
+	}
+	inputs[0].Focus()
+	m.paramOption = opt
+	m.paramDefs = params
+	m.paramInputs = inputs
+	m.paramFocus = 0
+	m.paramAction = action
+	m.mode = modeParams
+	m.running = false
+	m.status = helpParams
+	return m, textinput.Blink
+}
+
+// filledParamValue renders the option value with the form's current input.
+func (m model) filledParamValue() string {
+	values := map[string]string{}
+	for i, p := range m.paramDefs {
+		values[p.Name] = m.paramInputs[i].Value()
+	}
+	return fillParameters(m.paramOption.Value, values)
+}
+
+func (m *model) focusParam(delta int) {
+	m.paramInputs[m.paramFocus].Blur()
+	m.paramFocus = (m.paramFocus + delta + len(m.paramInputs)) % len(m.paramInputs)
+	m.paramInputs[m.paramFocus].Focus()
+}
+
+func (m model) handleParamKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc":
+		m.mode = modeViewing
+		m.editedFrom = ""
+		m.status = m.helpViewing()
+		return m, nil
+	case msg.Type == tea.KeyTab || msg.String() == "down":
+		m.focusParam(1)
+		return m, nil
+	case msg.Type == tea.KeyShiftTab || msg.String() == "up":
+		m.focusParam(-1)
+		return m, nil
+	case msg.Type == tea.KeyEnter:
+		opt := m.paramOption
+		opt.Value = m.filledParamValue()
+		opt.Parameters = nil
+		m.mode = modeViewing
+		m.status = m.helpViewing()
+		if m.paramAction == actionExecuted {
+			return m.runChecked(opt)
+		}
+		return m.copyValue(opt.Value)
+	}
+
+	var cmd tea.Cmd
+	m.paramInputs[m.paramFocus], cmd = m.paramInputs[m.paramFocus].Update(msg)
+	return m, cmd
+}
+
+// copyValue copies value to the clipboard and exits. With -output fd:N the
+// value goes to that file descriptor instead, for the shell widgets.
+func (m model) copyValue(value string) (tea.Model, tea.Cmd) {
+	if fd, ok := parseFDOutput(m.cfg.output); ok {
+		if err := writeToFD(fd, value); err != nil {
+			m.status = fmt.Sprintf("%s %v • %s", m.theme.glyphs.fail, err, m.helpViewing())
+			return m, nil
+		}
+		m.recordHistory(value, actionInserted)
+		return m, tea.Quit
+	}
+	if err := clipboard.WriteAll(value); err != nil {
+		m.status = fmt.Sprintf("%s CLIPBOARD FAILED: %v • Install xclip/xsel on Linux • %s", m.theme.glyphs.fail, err, m.helpViewing())
+		return m, nil
+	}
+	m.status = fmt.Sprintf("%s Copied to clipboard: %s", m.theme.glyphs.ok, value)
+	m.recordHistory(value, actionCopied)
+	return m, tea.Quit
+}
+
+func (m model) renderParamForm() string {
+	labelStyle := m.theme.fg(m.theme.info).Bold(true)
+	descStyle := m.theme.fg(m.theme.muted)
+	previewStyle := m.theme.fg(m.theme.text).Bold(true)
+
+	verb := "copy"
+	if m.paramAction == actionExecuted {
+		verb = "run"
+	}
+
+	var b strings.Builder
+	b.WriteString(labelStyle.Render("Fill in parameters to " + verb + ":"))
+	b.WriteString("\n")
+	for i, p := range m.paramDefs {
+		b.WriteString(m.paramInputs[i].View())
+		if p.Description != "" && m.paramInputs[i].Value() != "" {
+			b.WriteString(descStyle.Render("  # " + p.Description))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(descStyle.Render(m.theme.glyphs.arrow + " "))
+	b.WriteString(previewStyle.Render(cleanText(m.filledParamValue())))
+	b.WriteString("\n")
+	return b.String()
+}
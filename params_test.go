@@ -0,0 +1,71 @@
+package instassist
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestFillParametersQuotesForContext(t *testing.T) {
+	tests := []struct {
+		value  string
+		values map[string]string
+		want   string
+	}{
+		{"git checkout {{branch}}", map[string]string{"branch": "feature/x-1"}, "git checkout feature/x-1"},
+		{"git commit -m {{message}}", map[string]string{"message": "fix it's bug"}, `git commit -m 'fix it'\''s bug'`},
+		{`git commit -m "{{message}}"`, map[string]string{"message": `say "hi" $HOME`}, `git commit -m "say \"hi\" \$HOME"`},
+		{"echo '{{ text }}'", map[string]string{"text": "it's"}, `echo 'it'\''s'`},
+		{"touch {{name}}", map[string]string{"name": ""}, "touch ''"},
+		{"cp {{src}} {{dst}}", map[string]string{"src": "a b"}, "cp 'a b' {{dst}}"},
+		{`echo \"{{x}}`, map[string]string{"x": "a;b"}, `echo \"'a;b'`},
+	}
+	for _, tt := range tests {
+		if got := fillParameters(tt.value, tt.values); got != tt.want {
+			t.Errorf("fillParameters(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestOptionParameters(t *testing.T) {
+	opt := optionEntry{
+		Value: "git push {{remote}} {{branch}} && echo {{branch}} {{undeclared}}",
+		Parameters: []optionParam{
+			{Name: "branch", Description: "branch to push"},
+			{Name: "remote", Default: "origin"},
+			{Name: "unused"},
+		},
+	}
+	params := optionParameters(opt)
+	var names []string
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	if len(names) != 3 || names[0] != "branch" || names[1] != "remote" || names[2] != "undeclared" {
+		t.Fatalf("unexpected parameters: %q", names)
+	}
+
+	if _, err := resolveParameters(opt, map[string]string{"branch": "main"}); err == nil {
+		t.Fatalf("expected error for parameter without value or default")
+	}
+	got, err := resolveParameters(opt, map[string]string{"branch": "main", "undeclared": "x y"})
+	if err != nil {
+		t.Fatalf("resolveParameters returned error: %v", err)
+	}
+	if want := "git push origin main && echo main 'x y'"; got != want {
+		t.Fatalf("resolveParameters = %q, want %q", got, want)
+	}
+}
+
+func TestParamFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := registerFlags(fs)
+	if err := fs.Parse([]string{"-param", "branch=main", "-param", "msg=a=b"}); err != nil {
+		t.Fatal(err)
+	}
+	if f.params["branch"] != "main" || f.params["msg"] != "a=b" {
+		t.Fatalf("unexpected params: %v", f.params)
+	}
+	if err := f.params.Set("novalue"); err == nil {
+		t.Fatalf("expected error for missing '='")
+	}
+}
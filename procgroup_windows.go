@@ -0,0 +1,16 @@
+//go:build windows
+
+package instassist
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows; cancellation kills the process
+// itself.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
@@ -3,32 +3,214 @@ package instassist
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 type optionEntry struct {
-	Value               string `json:"value"`
-	Description         string `json:"description"`
-	RecommendationOrder int    `json:"recommendation_order"`
+	Value               string            `json:"value"`
+	Description         string            `json:"description"`
+	RecommendationOrder int               `json:"recommendation_order"`
+	Risk                string            `json:"risk,omitempty"`        // safe, caution or destructive
+	Explanation         string            `json:"explanation,omitempty"` // multi-line breakdown of the command
+	Requires            []string          `json:"requires,omitempty"`    // binaries the command depends on
+	Platform            string            `json:"platform,omitempty"`
+	Parameters          []optionParam     `json:"parameters,omitempty"` // placeholders referenced as {{name}}
+	Fields              map[string]string `json:"fields,omitempty"`     // extra fields asked for by the prompt mode
+	Providers           []string          `json:"providers,omitempty"`  // set when merging a compare run
+}
+
+// UnmarshalJSON decodes an option leniently: everything but value may be
+// missing, null or of a slightly wrong shape (a string instead of a list and
+// vice versa) without invalidating the whole response.
+func (o *optionEntry) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if value, ok := raw["value"]; ok {
+		if err := json.Unmarshal(value, &o.Value); err != nil {
+			return fmt.Errorf("option value: %w", err)
+		}
+	}
+	o.Description = lenientString(raw["description"], " ")
+	o.RecommendationOrder = lenientInt(raw["recommendation_order"])
+	o.Risk = normalizeRisk(lenientString(raw["risk"], " "))
+	o.Explanation = lenientString(raw["explanation"], "\n")
+	o.Requires = lenientList(raw["requires"])
+	o.Platform = lenientString(raw["platform"], ", ")
+	o.Parameters = lenientParams(raw["parameters"])
+	o.Fields = lenientFields(raw["fields"])
+	o.Providers = lenientList(raw["providers"])
+	return nil
+}
+
+// lenientFields accepts an object of scalars, stringifying numbers and
+// booleans and dropping nulls and nested values.
+func lenientFields(raw json.RawMessage) map[string]string {
+	var obj map[string]json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &obj) != nil {
+		return nil
+	}
+	fields := map[string]string{}
+	for name, value := range obj {
+		var scalar any
+		if json.Unmarshal(value, &scalar) != nil {
+			continue
+		}
+		switch v := scalar.(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				fields[name] = v
+			}
+		case float64, bool:
+			fields[name] = fmt.Sprint(v)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// lenientParams accepts a list of parameter objects, skipping entries
+// without a name and stringifying non-string defaults.
+func lenientParams(raw json.RawMessage) []optionParam {
+	var items []map[string]json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &items) != nil {
+		return nil
+	}
+	var params []optionParam
+	for _, item := range items {
+		name := lenientString(item["name"], "")
+		if name == "" {
+			continue
+		}
+		def := lenientString(item["default"], " ")
+		if def == "" && len(item["default"]) > 0 && string(item["default"]) != "null" {
+			var scalar any
+			if json.Unmarshal(item["default"], &scalar) == nil {
+				def = fmt.Sprint(scalar)
+			}
+		}
+		params = append(params, optionParam{
+			Name:        name,
+			Description: lenientString(item["description"], " "),
+			Default:     def,
+		})
+	}
+	return params
+}
+
+// lenientString accepts a string, or a list of strings joined with sep.
+func lenientString(raw json.RawMessage, sep string) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.TrimSpace(strings.Join(list, sep))
+	}
+	return ""
+}
+
+// lenientList accepts a list of strings, or a single comma/space separated
+// string.
+func lenientList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil
+		}
+		list = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	var out []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func lenientInt(raw json.RawMessage) int {
+	if len(raw) == 0 {
+		return 0
+	}
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		return int(f)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// normalizeRisk maps the model's risk wording onto safe, caution or
+// destructive; anything unrecognized is dropped.
+func normalizeRisk(risk string) string {
+	switch strings.ToLower(strings.TrimSpace(risk)) {
+	case "safe", "low", "none":
+		return "safe"
+	case "caution", "medium", "moderate", "warning":
+		return "caution"
+	case "destructive", "high", "dangerous", "critical":
+		return "destructive"
+	}
+	return ""
 }
 
 type optionResponse struct {
 	Options []optionEntry `json:"options"`
 }
 
-func buildPrompt(userPrompt string) string {
-	base := "Give me one or more concise, actionable options with short descriptions for the following. Favor shell commands as the option values whenever the request can be done via the command line; use non-command prose only when a command truly does not apply: "
+const defaultPreamble = "Give me one or more concise, actionable options with short descriptions for the following. Favor shell commands as the option values whenever the request can be done via the command line; use non-command prose only when a command truly does not apply: "
+
+// buildPrompt wraps the user's words with the preamble (the default one
+// when empty), the optional environment block and the JSON shape
+// instructions, including any extra fields of the prompt mode.
+func buildPrompt(preamble, envBlock, userPrompt string, fields ...modeField) string {
+	if strings.TrimSpace(preamble) == "" {
+		preamble = defaultPreamble
+	} else if !strings.HasSuffix(preamble, " ") && !strings.HasSuffix(preamble, "\n") {
+		preamble += " "
+	}
 	schema := `Respond ONLY with JSON shaped like {"options":[{"value":"...","description":"...","recommendation_order":1}]}. No extra text.`
-	return base + userPrompt + "\n" + schema
+	optional := `Each option may also include "risk" ("safe", "caution" or "destructive"), "explanation" (one line per flag or part of the command), "requires" (list of binaries the command needs) and "platform" (e.g. "linux", "macos", "windows" or "any"); use null when unknown. When the user must supply a value (a branch, a file, a message), write it in "value" as {{name}} and describe it in "parameters" as [{"name":"...","description":"...","default":"..."}].`
+	if envBlock != "" && !strings.HasSuffix(envBlock, "\n") {
+		envBlock += "\n"
+	}
+	if extra := fieldsInstruction(fields); extra != "" {
+		optional += " " + extra
+	}
+	return preamble + userPrompt + "\n" + envBlock + schema + "\n" + optional
 }
 
+// errNoOptions is returned for a well-formed response whose options array
+// is empty.
+var errNoOptions = errors.New("no options returned")
+
 func parseOptions(raw string) ([]optionEntry, error) {
 	var lastOpts []optionEntry
+	empty := false
 	search := raw
 	for {
 		idx := strings.Index(search, `{"options"`)
@@ -38,7 +220,11 @@ func parseOptions(raw string) ([]optionEntry, error) {
 		segment := search[idx:]
 		var resp optionResponse
 		decoder := json.NewDecoder(strings.NewReader(segment))
-		if err := decoder.Decode(&resp); err == nil && len(resp.Options) > 0 {
+		err := decoder.Decode(&resp)
+		if err == nil && resp.Options != nil && len(resp.Options) == 0 {
+			empty = true
+		}
+		if err == nil && len(resp.Options) > 0 {
 			opts := resp.Options
 			sort.SliceStable(opts, func(i, j int) bool {
 				oi := opts[i].RecommendationOrder
@@ -61,13 +247,18 @@ func parseOptions(raw string) ([]optionEntry, error) {
 	if len(lastOpts) > 0 {
 		return lastOpts, nil
 	}
+	if empty {
+		return nil, errNoOptions
+	}
 	return nil, fmt.Errorf("failed to parse options JSON")
 }
 
 func extractOptions(raw string) ([]optionEntry, error) {
-	if opts, err := parseOptions(raw); err == nil {
+	opts, err := parseOptions(raw)
+	if err == nil {
 		return opts, nil
 	}
+	empty := errors.Is(err, errNoOptions)
 
 	scanner := bufio.NewScanner(strings.NewReader(raw))
 	scanner.Buffer(make([]byte, 0, 2*1024*1024), 2*1024*1024)
@@ -80,48 +271,60 @@ func extractOptions(raw string) ([]optionEntry, error) {
 		if err := json.Unmarshal([]byte(line), &data); err != nil {
 			continue
 		}
-		if opts := findOptionsInValue(data); len(opts) > 0 {
+		if opts := findOptionsInValue(data, &empty); len(opts) > 0 {
 			return opts, nil
 		}
 	}
 
+	if empty {
+		return nil, errNoOptions
+	}
 	return nil, fmt.Errorf("failed to parse options JSON")
 }
 
-func findOptionsInValue(v any) []optionEntry {
+// findOptionsInValue looks for options anywhere in a decoded JSON value,
+// setting empty when it finds a valid options array with nothing in it.
+func findOptionsInValue(v any, empty *bool) []optionEntry {
 	switch val := v.(type) {
 	case map[string]any:
 		if optsVal, ok := val["options"]; ok {
-			if opts := decodeOptionsFromInterface(optsVal); len(opts) > 0 {
+			if opts := decodeOptionsFromInterface(optsVal, empty); len(opts) > 0 {
 				return opts
 			}
 		}
 		for _, nested := range val {
-			if opts := findOptionsInValue(nested); len(opts) > 0 {
+			if opts := findOptionsInValue(nested, empty); len(opts) > 0 {
 				return opts
 			}
 		}
 	case []any:
 		for _, item := range val {
-			if opts := findOptionsInValue(item); len(opts) > 0 {
+			if opts := findOptionsInValue(item, empty); len(opts) > 0 {
 				return opts
 			}
 		}
 	case string:
-		if opts, err := parseOptions(val); err == nil {
+		opts, err := parseOptions(val)
+		if err == nil {
 			return opts
 		}
+		if errors.Is(err, errNoOptions) {
+			*empty = true
+		}
 	}
 	return nil
 }
 
-func decodeOptionsFromInterface(v any) []optionEntry {
+func decodeOptionsFromInterface(v any, empty *bool) []optionEntry {
 	payload := map[string]any{"options": v}
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return nil
 	}
 	opts, err := parseOptions(string(b))
+	if errors.Is(err, errNoOptions) {
+		*empty = true
+	}
 	if err != nil {
 		return nil
 	}
@@ -223,15 +426,28 @@ func cleanText(s string) string {
 }
 
 func schemaSources() (string, string, error) {
+	return findSchema("options.schema.json", embeddedSchema)
+}
+
+// explainSchemaSources finds the schema of `inst explain` responses the
+// same way as the options schema.
+func explainSchemaSources() (string, string, error) {
+	return findSchema("explain.schema.json", embeddedExplainSchema)
+}
+
+// findSchema looks for the schema file name next to the binary, in the
+// working directory and in /usr/local/share/insta-assist, falling back to
+// a temp copy of the embedded one.
+func findSchema(name string, embedded []byte) (string, string, error) {
 	tryPaths := []string{}
 
 	if exe, err := os.Executable(); err == nil {
-		tryPaths = append(tryPaths, filepath.Join(filepath.Dir(exe), "options.schema.json"))
+		tryPaths = append(tryPaths, filepath.Join(filepath.Dir(exe), name))
 	}
 	if cwd, err := os.Getwd(); err == nil {
-		tryPaths = append(tryPaths, filepath.Join(cwd, "options.schema.json"))
+		tryPaths = append(tryPaths, filepath.Join(cwd, name))
 	}
-	tryPaths = append(tryPaths, "/usr/local/share/insta-assist/options.schema.json")
+	tryPaths = append(tryPaths, filepath.Join("/usr/local/share/insta-assist", name))
 
 	for _, p := range tryPaths {
 		if data, err := os.ReadFile(p); err == nil {
@@ -240,20 +456,20 @@ func schemaSources() (string, string, error) {
 	}
 
 	// Fallback to embedded schema if available by writing to a temp file
-	if len(embeddedSchema) > 0 {
-		tmp, err := os.CreateTemp("", "insta-options-schema-*.json")
+	if len(embedded) > 0 {
+		tmp, err := os.CreateTemp("", "insta-"+strings.ReplaceAll(strings.TrimSuffix(name, ".json"), ".", "-")+"-*.json")
 		if err != nil {
 			return "", "", fmt.Errorf("failed to create temp schema file: %w", err)
 		}
-		if _, err := tmp.Write(embeddedSchema); err != nil {
+		if _, err := tmp.Write(embedded); err != nil {
 			tmp.Close()
 			return "", "", fmt.Errorf("failed to write temp schema file: %w", err)
 		}
 		if err := tmp.Close(); err != nil {
 			return "", "", fmt.Errorf("failed to close temp schema file: %w", err)
 		}
-		return tmp.Name(), string(embeddedSchema), nil
+		return tmp.Name(), string(embedded), nil
 	}
 
-	return "", "", fmt.Errorf("options.schema.json not found in executable directory, working directory, or /usr/local/share/insta-assist")
+	return "", "", fmt.Errorf("%s not found in executable directory, working directory, or /usr/local/share/insta-assist", name)
 }
@@ -7,13 +7,36 @@ import (
 
 func TestBuildPromptIncludesUserTextAndSchema(t *testing.T) {
 	user := "list files"
-	prompt := buildPrompt(user)
+	prompt := buildPrompt("", "", user)
 	if !strings.Contains(prompt, user) {
 		t.Fatalf("expected prompt to contain user text %q", user)
 	}
 	if !strings.Contains(prompt, `"options":[{"value":"...","description":"...","recommendation_order":1}]`) {
 		t.Fatalf("expected prompt to include schema hint, got: %s", prompt)
 	}
+	if !strings.HasPrefix(prompt, defaultPreamble) {
+		t.Fatalf("expected default preamble, got: %s", prompt)
+	}
+}
+
+func TestBuildPromptUsesCustomPreamble(t *testing.T) {
+	prompt := buildPrompt("Answer with PowerShell commands:", "", "list files")
+	if !strings.HasPrefix(prompt, "Answer with PowerShell commands: list files\n") {
+		t.Fatalf("expected custom preamble before user text, got: %s", prompt)
+	}
+}
+
+func TestBuildPromptIncludesEnvironmentBlock(t *testing.T) {
+	env := envInfo{os: "linux", distro: "Arch Linux", shell: "zsh", cwd: "/src/app", gitRepo: true, gitBranch: "main", tools: []string{"rg", "jq"}}
+	prompt := buildPrompt("", env.block(), "find TODOs")
+	for _, want := range []string{"find TODOs\nEnvironment", "- OS: linux (Arch Linux)", "- Shell: zsh", "branch main", "- Installed tools: rg, jq\nRespond ONLY"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("expected prompt to contain %q, got: %s", want, prompt)
+		}
+	}
+	if strings.Contains(buildPrompt("", "", "find TODOs"), "Environment") {
+		t.Fatalf("expected no environment block when context is off")
+	}
 }
 
 func TestParseOptionsPrefersLastValidBlock(t *testing.T) {
@@ -97,3 +120,53 @@ func TestExtractSessionID(t *testing.T) {
 		})
 	}
 }
+
+func TestParseOptionsOptionalFields(t *testing.T) {
+	raw := `{"options":[
+{"value":"rg -l TODO | xargs sed -i 's/TODO/DONE/'","description":"d","recommendation_order":"1","risk":"High","explanation":["rg -l: list matching files","sed -i: edit in place"],"requires":"rg, sed","platform":["linux","macos"]},
+{"value":"ls","description":"d","recommendation_order":2,"risk":null,"explanation":null,"requires":null,"platform":null},
+{"value":"head -n {{n}} {{file}}","description":"d","recommendation_order":3,"risk":7,"requires":["  "],"parameters":[{"name":"n","default":10},{"name":"file","description":"file to read","default":null},{"description":"nameless"}]}
+]}`
+	opts, err := parseOptions(raw)
+	if err != nil {
+		t.Fatalf("parseOptions returned error: %v", err)
+	}
+	if len(opts) != 3 {
+		t.Fatalf("expected 3 options, got %d", len(opts))
+	}
+	first := opts[0]
+	if first.RecommendationOrder != 1 || first.Risk != "destructive" {
+		t.Fatalf("unexpected order/risk: %+v", first)
+	}
+	if first.Explanation != "rg -l: list matching files\nsed -i: edit in place" {
+		t.Fatalf("unexpected explanation: %q", first.Explanation)
+	}
+	if len(first.Requires) != 2 || first.Requires[0] != "rg" || first.Requires[1] != "sed" {
+		t.Fatalf("unexpected requires: %q", first.Requires)
+	}
+	if first.Platform != "linux, macos" {
+		t.Fatalf("unexpected platform: %q", first.Platform)
+	}
+	if opts[1].Risk != "" || opts[1].Requires != nil {
+		t.Fatalf("nulls should leave fields empty: %+v", opts[1])
+	}
+	if opts[2].Risk != "" || len(opts[2].Requires) != 0 {
+		t.Fatalf("invalid values should be dropped: %+v", opts[2])
+	}
+	if params := opts[2].Parameters; len(params) != 2 || params[0].Default != "10" || params[1].Description != "file to read" || params[1].Default != "" {
+		t.Fatalf("unexpected parameters: %+v", opts[2].Parameters)
+	}
+
+	if !platformMatches("linux, macos", "darwin") || platformMatches("windows", "linux") || !platformMatches("", "linux") {
+		t.Fatalf("unexpected platformMatches result")
+	}
+	for platform, want := range map[string]bool{"darwin": false, "macOS": false, "win32": true, "Windows 10+": true, "linux/darwin": false} {
+		if got := platformMatches(platform, "windows"); got != want {
+			t.Errorf("platformMatches(%q, windows) = %v, want %v", platform, got, want)
+		}
+	}
+	missing := missingRequirements(first, func(name string) bool { return name == "sed" })
+	if len(missing) != 1 || missing[0] != "rg" {
+		t.Fatalf("unexpected missing requirements: %q", missing)
+	}
+}
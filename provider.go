@@ -0,0 +1,196 @@
+package instassist
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// providerCaps describes the optional features a provider supports.
+type providerCaps struct {
+	yolo   bool // has an auto-approve / skip-permissions switch
+	schema bool // enforces the JSON schema natively, not just via the prompt
+	resume bool // can continue a previous session by ID
+}
+
+// schemaSpec carries the options schema both as a file path (for CLIs that
+// take a path) and as raw JSON (for CLIs and APIs that take it inline).
+type schemaSpec struct {
+	path string
+	json string
+}
+
+type providerRequest struct {
+	prompt string
+	yolo   bool
+	schema schemaSpec
+	// onLine, when set, receives each line of output as it is produced so
+	// progress can be shown before the run finishes.
+	onLine func(line string)
+}
+
+// provider is a backend that turns a prompt into raw output containing an
+// options JSON block. Both the TUI and non-interactive mode go through it.
+type provider interface {
+	name() string
+	available() bool
+	caps() providerCaps
+	run(ctx context.Context, req providerRequest) ([]byte, error)
+	resume(ctx context.Context, req providerRequest, sessionID string) ([]byte, error)
+}
+
+// cliProvider shells out to an external agent CLI.
+type cliProvider struct {
+	id       string
+	binary   string
+	features providerCaps
+	// args builds the argv (without the binary) and optional stdin for a
+	// request. sessionID is empty for fresh runs.
+	args func(req providerRequest, sessionID string) ([]string, string)
+}
+
+func (p cliProvider) name() string {
+	return p.id
+}
+
+func (p cliProvider) available() bool {
+	return cliAvailable(p.binary)
+}
+
+func (p cliProvider) caps() providerCaps {
+	return p.features
+}
+
+func (p cliProvider) run(ctx context.Context, req providerRequest) ([]byte, error) {
+	return p.exec(ctx, req, "")
+}
+
+func (p cliProvider) resume(ctx context.Context, req providerRequest, sessionID string) ([]byte, error) {
+	return p.exec(ctx, req, sessionID)
+}
+
+func (p cliProvider) exec(ctx context.Context, req providerRequest, sessionID string) ([]byte, error) {
+	args, stdin := p.args(req, sessionID)
+	cmd := exec.CommandContext(ctx, p.binary, args...)
+	setProcessGroup(cmd)
+	// Don't wait forever on pipes held open by a process that escaped the
+	// group.
+	cmd.WaitDelay = 2 * time.Second
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if req.onLine == nil {
+		return cmd.CombinedOutput()
+	}
+	var out bytes.Buffer
+	lines := &lineWriter{fn: req.onLine}
+	w := io.MultiWriter(&out, lines)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	lines.flush()
+	return out.Bytes(), err
+}
+
+func builtinProviders() []provider {
+	providers := []provider{
+		cliProvider{
+			id:       "codex",
+			binary:   "codex",
+			features: providerCaps{yolo: true, schema: true, resume: true},
+			args: func(req providerRequest, sessionID string) ([]string, string) {
+				args := []string{"exec"}
+				if req.yolo {
+					args = append(args, "--yolo")
+				}
+				args = append(args, "--output-schema", req.schema.path, "--skip-git-repo-check", "--json")
+				if sessionID != "" {
+					args = append(args, "resume", sessionID, "-")
+				}
+				return args, req.prompt
+			},
+		},
+		cliProvider{
+			id:       "claude",
+			binary:   "claude",
+			features: providerCaps{yolo: true, schema: true, resume: true},
+			args: func(req providerRequest, sessionID string) ([]string, string) {
+				args := []string{"-p", req.prompt, "--print", "--output-format", "stream-json", "--verbose", "--json-schema", req.schema.json}
+				if sessionID != "" {
+					args = append(args, "--resume", sessionID)
+				}
+				if req.yolo {
+					args = append(args, "--dangerously-skip-permissions")
+				}
+				return args, ""
+			},
+		},
+		cliProvider{
+			id:       "gemini",
+			binary:   "gemini",
+			features: providerCaps{yolo: true, resume: true},
+			args: func(req providerRequest, sessionID string) ([]string, string) {
+				args := []string{"--output-format", "json"}
+				if sessionID != "" {
+					args = append(args, "--resume", sessionID)
+				}
+				if req.yolo {
+					args = append(args, "--yolo")
+				}
+				return append(args, req.prompt), ""
+			},
+		},
+		cliProvider{
+			id:       "opencode",
+			binary:   "opencode",
+			features: providerCaps{resume: true},
+			args: func(req providerRequest, sessionID string) ([]string, string) {
+				args := []string{"run", "--format", "json"}
+				if sessionID != "" {
+					args = append(args, "--session", sessionID)
+				}
+				return append(args, req.prompt), ""
+			},
+		},
+	}
+	return append(providers, httpProviders()...)
+}
+
+// sendPrompt resumes sessionID when one is given and the provider supports
+// it, and starts a fresh run otherwise.
+func sendPrompt(ctx context.Context, p provider, req providerRequest, sessionID string) ([]byte, error) {
+	if sessionID != "" && p.caps().resume {
+		return p.resume(ctx, req, sessionID)
+	}
+	return p.run(ctx, req)
+}
+
+func lookupProvider(providers []provider, name string) (provider, bool) {
+	for _, p := range providers {
+		if strings.EqualFold(p.name(), name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func availableProviders(providers []provider) []provider {
+	var out []provider
+	for _, p := range providers {
+		if p.available() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func providerNames(providers []provider) []string {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.name())
+	}
+	return names
+}
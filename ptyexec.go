@@ -0,0 +1,400 @@
+package instassist
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/creack/pty"
+)
+
+const (
+	helpExecRunning = "ctrl+c: interrupt (twice: kill) • pgup/pgdn: scroll • other keys go to the command"
+	helpExecDone    = "esc/enter: back to options • pgup/pgdn: scroll • q: quit"
+
+	termMaxLines = 5000
+)
+
+// termBuffer turns raw PTY output into plain text lines. It applies
+// carriage returns, backspaces and tabs the way a terminal would and drops
+// escape sequences, which is enough for progress bars and prompts without
+// emulating a full terminal.
+type termBuffer struct {
+	lines   []string
+	line    []rune
+	col     int
+	state   int    // escape parser state
+	partial []byte // incomplete UTF-8 sequence from the previous write
+}
+
+const (
+	termNormal = iota
+	termEscape
+	termCSI
+	termOSC
+	termOSCEscape
+)
+
+func (t *termBuffer) Write(p []byte) (int, error) {
+	data := append(t.partial, p...)
+	t.partial = nil
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			t.partial = append([]byte(nil), data...)
+			break
+		}
+		data = data[size:]
+		t.put(r)
+	}
+	return len(p), nil
+}
+
+func (t *termBuffer) put(r rune) {
+	switch t.state {
+	case termEscape:
+		switch r {
+		case '[':
+			t.state = termCSI
+		case ']':
+			t.state = termOSC
+		default:
+			t.state = termNormal
+		}
+		return
+	case termCSI:
+		if r >= 0x40 && r <= 0x7e {
+			t.state = termNormal
+		}
+		return
+	case termOSC:
+		if r == '\a' {
+			t.state = termNormal
+		} else if r == 0x1b {
+			t.state = termOSCEscape
+		}
+		return
+	case termOSCEscape:
+		t.state = termNormal
+		return
+	}
+
+	switch r {
+	case 0x1b:
+		t.state = termEscape
+	case '\n':
+		t.lines = append(t.lines, string(t.line))
+		if len(t.lines) > termMaxLines {
+			t.lines = t.lines[len(t.lines)-termMaxLines:]
+		}
+		t.line = t.line[:0]
+		t.col = 0
+	case '\r':
+		t.col = 0
+	case '\b':
+		if t.col > 0 {
+			t.col--
+		}
+	case '\t':
+		for {
+			t.putPrintable(' ')
+			if t.col%8 == 0 {
+				break
+			}
+		}
+	default:
+		if r >= 0x20 && r != 0x7f {
+			t.putPrintable(r)
+		}
+	}
+}
+
+func (t *termBuffer) putPrintable(r rune) {
+	if t.col < len(t.line) {
+		t.line[t.col] = r
+	} else {
+		t.line = append(t.line, r)
+	}
+	t.col++
+}
+
+func (t *termBuffer) String() string {
+	text := strings.Join(t.lines, "\n")
+	if len(t.line) > 0 {
+		if text != "" {
+			text += "\n"
+		}
+		text += string(t.line)
+	}
+	return text
+}
+
+// ptyRun is a stay-open command running in a pseudo-terminal.
+type ptyRun struct {
+	id         int
+	command    string
+	cmd        *exec.Cmd
+	pty        *os.File
+	events     chan tea.Msg
+	output     *termBuffer
+	started    time.Time
+	finished   time.Time
+	done       bool
+	err        error
+	interrupts int
+}
+
+type ptyOutputMsg struct {
+	id   int
+	data []byte
+}
+
+type ptyExitMsg struct {
+	id  int
+	err error
+}
+
+type ptyTickMsg struct{ id int }
+
+func waitPTY(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func ptyTick(id int) tea.Cmd {
+	return tea.Tick(time.Second/2, func(time.Time) tea.Msg { return ptyTickMsg{id: id} })
+}
+
+// startPTY runs value in a pseudo-terminal sized to the output viewport and
+// streams its output into the TUI. Platforms without PTY support fall back
+// to collecting the combined output.
+func (m model) startPTY(value string) (tea.Model, tea.Cmd) {
+	width, height := m.execViewportSize()
+	cmd := exec.Command("sh", "-c", value)
+	cmd.Env = append(os.Environ(), "TERM=dumb")
+	f, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(height), Cols: uint16(width)})
+	if err != nil {
+		return m, func() tea.Msg {
+			out, err := exec.Command("sh", "-c", value).CombinedOutput()
+			return execResultMsg{err: err, exit: false, output: string(out), command: value}
+		}
+	}
+
+	m.execSeq++
+	run := &ptyRun{
+		id:      m.execSeq,
+		command: value,
+		cmd:     cmd,
+		pty:     f,
+		events:  make(chan tea.Msg, 64),
+		output:  &termBuffer{},
+		started: time.Now(),
+	}
+	go run.read()
+
+	m.execRun = run
+	m.execView = viewport.New(width, height)
+	m.mode = modeExec
+	m.status = helpExecRunning
+	return m, tea.Batch(waitPTY(run.events), ptyTick(run.id))
+}
+
+// read forwards PTY output until the command closes it, then reports the
+// exit status.
+func (r *ptyRun) read() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.pty.Read(buf)
+		if n > 0 {
+			r.events <- ptyOutputMsg{id: r.id, data: append([]byte(nil), buf[:n]...)}
+		}
+		if err != nil {
+			// Linux reports EIO once the child side is closed.
+			break
+		}
+	}
+	err := r.cmd.Wait()
+	r.pty.Close()
+	r.events <- ptyExitMsg{id: r.id, err: err}
+}
+
+func (m model) execViewportSize() (int, int) {
+	width := m.width - 2
+	if width < 20 {
+		width = 20
+	}
+	height := m.height - 4
+	if height < 3 {
+		height = 3
+	}
+	return width, height
+}
+
+func (m model) handlePTYMsg(msg tea.Msg) (tea.Model, tea.Cmd) {
+	run := m.execRun
+	switch msg := msg.(type) {
+	case ptyOutputMsg:
+		if run == nil || msg.id != run.id {
+			return m, nil
+		}
+		atBottom := m.execView.AtBottom()
+		run.output.Write(msg.data)
+		m.execView.SetContent(run.output.String())
+		if atBottom {
+			m.execView.GotoBottom()
+		}
+		return m, waitPTY(run.events)
+	case ptyExitMsg:
+		if run == nil || msg.id != run.id {
+			return m, nil
+		}
+		run.done = true
+		run.err = msg.err
+		run.finished = time.Now()
+		m.execView.SetContent(run.output.String())
+		m.execView.GotoBottom()
+		m.status = helpExecDone
+		return m, nil
+	case ptyTickMsg:
+		if run == nil || msg.id != run.id || run.done {
+			return m, nil
+		}
+		return m, ptyTick(run.id)
+	}
+	return m, nil
+}
+
+func (m model) handleExecKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	run := m.execRun
+	switch msg.String() {
+	case "pgup":
+		m.execView.HalfPageUp()
+		return m, nil
+	case "pgdown":
+		m.execView.HalfPageDown()
+		return m, nil
+	}
+
+	if run.done {
+		switch msg.String() {
+		case "esc", "enter":
+			return m.closeExec(), nil
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			m.execView.LineUp(1)
+		case "down", "j":
+			m.execView.LineDown(1)
+		}
+		return m, nil
+	}
+
+	if msg.Type == tea.KeyCtrlC {
+		run.interrupts++
+		if run.interrupts == 1 {
+			// ^C through the terminal reaches the foreground process group,
+			// just like pressing it in a shell.
+			run.pty.Write([]byte{0x03})
+			m.status = "sent interrupt • ctrl+c again to kill"
+		} else {
+			// The PTY made the command a session leader, so this takes
+			// down everything it started too.
+			killProcessGroup(run.cmd.Process)
+			m.status = "killed • waiting for output to close"
+		}
+		return m, nil
+	}
+	if seq := keyBytes(msg); seq != "" {
+		run.pty.Write([]byte(seq))
+	}
+	return m, nil
+}
+
+// keyBytes translates a key press into what a terminal would send.
+func keyBytes(msg tea.KeyMsg) string {
+	switch msg.Type {
+	case tea.KeyRunes:
+		if msg.Alt {
+			return "\x1b" + string(msg.Runes)
+		}
+		return string(msg.Runes)
+	case tea.KeySpace:
+		return " "
+	case tea.KeyEnter:
+		return "\r"
+	case tea.KeyTab:
+		return "\t"
+	case tea.KeyBackspace:
+		return "\x7f"
+	case tea.KeyEsc:
+		return "\x1b"
+	case tea.KeyUp:
+		return "\x1b[A"
+	case tea.KeyDown:
+		return "\x1b[B"
+	case tea.KeyRight:
+		return "\x1b[C"
+	case tea.KeyLeft:
+		return "\x1b[D"
+	case tea.KeyDelete:
+		return "\x1b[3~"
+	}
+	if msg.Type >= tea.KeyCtrlA && msg.Type <= tea.KeyCtrlZ {
+		return string(rune(msg.Type))
+	}
+	return ""
+}
+
+// closeExec returns to the options, keeping the output and the failure for
+// the f key when the command did not succeed.
+func (m model) closeExec() model {
+	run := m.execRun
+	m.execRun = nil
+	m.mode = modeViewing
+	m.execOutput = run.output.String()
+	m.status = "command finished • " + m.helpViewing()
+	if run.err != nil {
+		output := m.execOutput
+		if len(output) > fixOutputLimit {
+			output = output[len(output)-fixOutputLimit:]
+		}
+		m.lastFailure = &failedRun{command: run.command, exitCode: exitCodeOf(run.err), output: output, err: run.err}
+		m.status = fmt.Sprintf("%s exec failed: %v • %s: ask AI to fix • %s", m.theme.glyphs.fail, run.err, firstKey(m.keys.Fix), m.helpViewing())
+	}
+	return m
+}
+
+func (m model) renderExec() string {
+	run := m.execRun
+	commandStyle := m.theme.fg(m.theme.text).Bold(true)
+	metaStyle := m.theme.fg(m.theme.muted)
+	okStyle := m.theme.fg(m.theme.success).Bold(true)
+	failStyle := m.theme.fg(m.theme.failure).Bold(true)
+
+	var b strings.Builder
+	b.WriteString(commandStyle.Render("$ " + cleanText(run.command)))
+	if run.done {
+		elapsed := run.finished.Sub(run.started).Round(100 * time.Millisecond)
+		code := exitCodeOf(run.err)
+		if run.err == nil {
+			b.WriteString(okStyle.Render(fmt.Sprintf("  %s exit 0 %s %s", m.theme.glyphs.ok, m.theme.glyphs.bullet, elapsed)))
+		} else if code >= 0 {
+			b.WriteString(failStyle.Render(fmt.Sprintf("  %s exit %d %s %s", m.theme.glyphs.fail, code, m.theme.glyphs.bullet, elapsed)))
+		} else {
+			b.WriteString(failStyle.Render(fmt.Sprintf("  %s %v %s %s", m.theme.glyphs.fail, run.err, m.theme.glyphs.bullet, elapsed)))
+		}
+	} else {
+		elapsed := time.Since(run.started).Round(time.Second)
+		b.WriteString(metaStyle.Render(fmt.Sprintf("  running %s %s", m.theme.glyphs.bullet, elapsed)))
+	}
+	b.WriteString("\n")
+	b.WriteString(m.execView.View())
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package instassist
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTermBuffer(t *testing.T) {
+	var tb termBuffer
+	tb.Write([]byte("progress 10%\rprogress 100%\r\n"))
+	tb.Write([]byte("\x1b[1;32mok\x1b[0m\tdone\n"))
+	tb.Write([]byte("\x1b]0;title\x07abc\bX"))
+	// A multi-byte rune split across writes must not be lost.
+	tb.Write([]byte{' ', 0xe2, 0x9c})
+	tb.Write([]byte{0x93})
+
+	want := "progress 100%\nok      done\nabX ✓"
+	if got := tb.String(); got != want {
+		t.Fatalf("termBuffer = %q, want %q", got, want)
+	}
+}
+
+func TestKeyBytes(t *testing.T) {
+	tests := []struct {
+		msg  tea.KeyMsg
+		want string
+	}{
+		{tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")}, "y"},
+		{tea.KeyMsg{Type: tea.KeyEnter}, "\r"},
+		{tea.KeyMsg{Type: tea.KeyCtrlD}, "\x04"},
+		{tea.KeyMsg{Type: tea.KeyUp}, "\x1b[A"},
+		{tea.KeyMsg{Type: tea.KeyF1}, ""},
+	}
+	for _, tt := range tests {
+		if got := keyBytes(tt.msg); got != tt.want {
+			t.Errorf("keyBytes(%v) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package instassist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fixOutputLimit caps how much of a failed command's output is kept and
+// sent back to the model; the end of the output is the useful part.
+const fixOutputLimit = 4000
+
+// failedRun describes a command that exited unsuccessfully.
+type failedRun struct {
+	command  string
+	exitCode int
+	output   string
+	err      error
+}
+
+// tailBuffer is an io.Writer that keeps only the last limit bytes.
+type tailBuffer struct {
+	limit int
+	buf   []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// exitCodeOf returns the process exit code carried by err, or -1 when the
+// command did not run to completion.
+func exitCodeOf(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// fixPrompt asks for corrected options after a failure. original restates
+// the user's request when the provider has no session to resume.
+func fixPrompt(f failedRun, original string) string {
+	var b strings.Builder
+	if original != "" {
+		b.WriteString("Original request: " + original + "\n")
+	}
+	b.WriteString("I ran one of your suggestions and it failed.\n")
+	b.WriteString("Command: " + f.command + "\n")
+	fmt.Fprintf(&b, "Exit code: %d\n", f.exitCode)
+	output := strings.TrimSpace(f.output)
+	if output == "" {
+		output = "(no output)"
+	}
+	b.WriteString("Output:\n" + output + "\n")
+	b.WriteString("Suggest corrected options that achieve the original request.")
+	return b.String()
+}
+
+// runCaptured runs command in sh with the terminal attached, keeping the
+// tail of its combined output for a possible fix request. It returns nil
+// when the command succeeds.
+func runCaptured(command string) *failedRun {
+	tail := &tailBuffer{limit: fixOutputLimit}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return &failedRun{command: command, exitCode: exitCodeOf(err), output: tail.String(), err: err}
+	}
+	return nil
+}
+
+// requestFix resumes the session with the last failed run and asks for
+// corrected options. Without a resumable session the original request is
+// sent again along with the failure.
+func (m model) requestFix() (tea.Model, tea.Cmd) {
+	if m.lastFailure == nil {
+		m.status = "no failed run to fix • " + m.helpViewing()
+		return m, nil
+	}
+	f := *m.lastFailure
+	m.lastFailure = nil
+
+	original := strings.Join(m.promptHistory, "\n")
+	m.promptHistory = append(m.promptHistory, fmt.Sprintf("fix: %s (exit %d)", cleanText(f.command), f.exitCode))
+	m.autoExecute = false
+
+	p := m.currentCLI()
+	if sessionID := m.sessionIDs[p.name()]; sessionID != "" && p.caps().resume {
+		return m.startRequest(m.promptFor(fixPrompt(f, ""), true), sessionID)
+	}
+	return m.startRequest(m.promptFor(fixPrompt(f, original), false), "")
+}
@@ -0,0 +1,78 @@
+package instassist
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/textarea"
+)
+
+func TestTailBufferKeepsEnd(t *testing.T) {
+	tail := &tailBuffer{limit: 5}
+	tail.Write([]byte("abc"))
+	tail.Write([]byte("defgh"))
+	if got := tail.String(); got != "defgh" {
+		t.Fatalf("tail = %q, want %q", got, "defgh")
+	}
+}
+
+func TestFixPrompt(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if code := exitCodeOf(err); code != 3 {
+		t.Fatalf("exitCodeOf = %d, want 3", code)
+	}
+
+	f := failedRun{command: "tar xf a.tgz", exitCode: 2, output: "tar: a.tgz: Cannot open\n"}
+	resumed := fixPrompt(f, "")
+	for _, want := range []string{"Command: tar xf a.tgz", "Exit code: 2", "tar: a.tgz: Cannot open"} {
+		if !strings.Contains(resumed, want) {
+			t.Fatalf("expected %q in fix prompt, got: %s", want, resumed)
+		}
+	}
+	if strings.Contains(resumed, "Original request") {
+		t.Fatalf("resumed fix prompt should not restate the request")
+	}
+	if fresh := fixPrompt(f, "extract the archive"); !strings.HasPrefix(fresh, "Original request: extract the archive\n") {
+		t.Fatalf("expected original request first, got: %s", fresh)
+	}
+}
+
+func TestCancelledRefineKeepsSession(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	m := model{
+		cfg:           defaultConfig(),
+		keys:          defaultKeyMap(),
+		input:         textarea.New(),
+		providers:     []provider{cliProvider{id: "codex", features: providerCaps{resume: true}}},
+		sessionIDs:    map[string]string{"codex": "sess-1"},
+		promptHistory: []string{"list files"},
+		mode:          modeRefine,
+	}
+	m.pendingResumeID = "sess-1"
+	m.input.SetValue("only large ones")
+
+	next, _ := m.submitPrompt()
+	m = next.(model).cancelRunning()
+	if m.mode != modeRefine || m.input.Value() != "only large ones" || m.pendingResumeID != "sess-1" {
+		t.Fatalf("expected the refine back in the input on its session, got mode %v %q %q", m.mode, m.input.Value(), m.pendingResumeID)
+	}
+	if strings.Join(m.promptHistory, "|") != "list files" {
+		t.Fatalf("expected only the refine dropped from the history, got %q", m.promptHistory)
+	}
+
+	next, _ = m.submitPrompt()
+	m = next.(model)
+	if strings.Join(m.promptHistory, "|") != "list files|only large ones" || m.pendingResumeID != "sess-1" {
+		t.Errorf("expected the refine to resume sess-1 again, got %q %q", m.promptHistory, m.pendingResumeID)
+	}
+
+	// A cancelled fix also stays on the session.
+	m.stopRequest()
+	m.lastFailure = &failedRun{command: "make", exitCode: 2}
+	next, _ = m.requestFix()
+	m = next.(model).cancelRunning()
+	if m.mode != modeRefine || m.pendingResumeID != "sess-1" || len(m.promptHistory) != 2 {
+		t.Errorf("expected a cancelled fix to keep the session and history, got mode %v %q %q", m.mode, m.pendingResumeID, m.promptHistory)
+	}
+}
@@ -0,0 +1,548 @@
+package instassist
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+type riskLevel int
+
+const (
+	riskSafe riskLevel = iota
+	riskCaution
+	riskDestructive
+)
+
+func (r riskLevel) String() string {
+	switch r {
+	case riskCaution:
+		return "caution"
+	case riskDestructive:
+		return "destructive"
+	}
+	return "safe"
+}
+
+// riskReport is the result of analyzing a suggested command.
+type riskReport struct {
+	level   riskLevel
+	reasons []string
+}
+
+func (r *riskReport) flag(level riskLevel, reason string) {
+	if level > r.level {
+		r.level = level
+	}
+	for _, existing := range r.reasons {
+		if existing == reason {
+			return
+		}
+	}
+	r.reasons = append(r.reasons, reason)
+}
+
+// merge folds in the report of a nested command, such as the script of
+// bash -c.
+func (r *riskReport) merge(other riskReport) {
+	for _, reason := range other.reasons {
+		r.flag(other.level, reason)
+	}
+}
+
+// withDeclared folds in the risk the model declared for an option. The
+// declaration can only raise the analyzer's verdict, never lower it.
+func (r riskReport) withDeclared(declared string) riskReport {
+	var level riskLevel
+	switch declared {
+	case "caution":
+		level = riskCaution
+	case "destructive":
+		level = riskDestructive
+	default:
+		return r
+	}
+	out := riskReport{level: r.level, reasons: append([]string(nil), r.reasons...)}
+	out.flag(level, "marked "+declared+" by the model")
+	return out
+}
+
+var (
+	shells            = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true}
+	shellInterpreters = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true, "python": true, "python3": true, "perl": true, "ruby": true, "node": true}
+	downloaders       = map[string]bool{"curl": true, "wget": true, "fetch": true}
+	diskTools         = map[string]bool{"mkfs": true, "mke2fs": true, "mkswap": true, "wipefs": true, "fdisk": true, "sfdisk": true, "gdisk": true, "sgdisk": true, "parted": true, "shred": true}
+	blockDevPrefixes  = []string{"/dev/sd", "/dev/hd", "/dev/vd", "/dev/xvd", "/dev/nvme", "/dev/mmcblk", "/dev/disk", "/dev/rdisk", "/dev/mapper/"}
+)
+
+// wrapper is a command that runs the command after its own options, like
+// sudo. values are the options that take a separate argument, and
+// positional counts the arguments before the command, like timeout's
+// duration.
+type wrapper struct {
+	values     []string
+	positional int
+}
+
+var wrappers = map[string]wrapper{
+	"sudo":    {values: []string{"-u", "-g", "-h", "-p", "-C", "-D", "-r", "-t", "-T", "-U", "--user", "--group", "--host", "--prompt", "--close-from", "--chdir", "--role", "--type", "--command-timeout", "--other-user"}},
+	"doas":    {values: []string{"-u", "-C"}},
+	"env":     {values: []string{"-u", "-C", "--unset", "--chdir"}},
+	"command": {},
+	"exec":    {values: []string{"-a"}},
+	"nohup":   {},
+	"time":    {values: []string{"-f", "-o", "--format", "--output"}},
+	"nice":    {values: []string{"-n", "--adjustment"}},
+	"ionice":  {values: []string{"-c", "-n", "-p", "--class", "--classdata"}},
+	"timeout": {values: []string{"-s", "-k", "--signal", "--kill-after"}, positional: 1},
+	"xargs":   {values: []string{"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter", "--max-args", "--max-lines", "--max-procs", "--max-chars", "--replace"}},
+}
+
+// analyzeRisk parses a suggested shell command and flags destructive
+// patterns. Text that is not valid shell can't be checked, so it is flagged
+// for caution rather than passed as safe.
+func analyzeRisk(command string) riskReport {
+	var report riskReport
+	if strings.TrimSpace(command) == "" {
+		return report
+	}
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		report.flag(riskCaution, "could not parse command")
+		return report
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			checkCall(&report, callArgs(n))
+			checkSubstScript(&report, n)
+		case *syntax.Stmt:
+			for _, r := range n.Redirs {
+				checkRedirect(&report, r)
+			}
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.Pipe || n.Op == syntax.PipeAll {
+				checkPipe(&report, n)
+			}
+		case *syntax.FuncDecl:
+			if n.Name != nil && callsItself(n) {
+				report.flag(riskDestructive, "defines a self-recursive function (fork bomb)")
+			}
+		}
+		return true
+	})
+	return report
+}
+
+// wordText renders a word with quotes removed; expansions are kept as "$".
+func wordText(w *syntax.Word) string {
+	var sb strings.Builder
+	var walkParts func(parts []syntax.WordPart)
+	walkParts = func(parts []syntax.WordPart) {
+		for _, part := range parts {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				sb.WriteString(p.Value)
+			case *syntax.SglQuoted:
+				sb.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				walkParts(p.Parts)
+			default:
+				sb.WriteString("$")
+			}
+		}
+	}
+	walkParts(w.Parts)
+	return sb.String()
+}
+
+func callArgs(call *syntax.CallExpr) []string {
+	args := make([]string, 0, len(call.Args))
+	for _, w := range call.Args {
+		args = append(args, wordText(w))
+	}
+	return args
+}
+
+// unwrap strips wrapper commands like sudo and env VAR=x, returning the
+// argv of the command that actually runs.
+func unwrap(args []string) []string {
+	for len(args) > 0 {
+		w, ok := wrappers[path.Base(args[0])]
+		if !ok {
+			break
+		}
+		args = args[1:]
+	options:
+		for len(args) > 0 {
+			a := args[0]
+			switch {
+			case a == "--":
+				args = args[1:]
+				break options
+			case strings.HasPrefix(a, "-"):
+				args = args[1:]
+				if slices.Contains(w.values, a) && len(args) > 0 {
+					args = args[1:]
+				}
+			case strings.Contains(a, "="):
+				args = args[1:] // env VAR=x
+			default:
+				break options
+			}
+		}
+		args = args[min(w.positional, len(args)):]
+	}
+	return args
+}
+
+// hasFlag reports whether args contain the short flag letter (also inside
+// combined flags like -rf) or any of the given long flags.
+func hasFlag(args []string, short byte, long ...string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		for _, l := range long {
+			if a == l {
+				return true
+			}
+		}
+		if short != 0 && len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], short) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func operands(args []string) []string {
+	var out []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func isRootLike(target string) bool {
+	switch strings.TrimRight(target, "/") {
+	case "", "~", "$", "/*", "*", "$/*", "~/*", ".", "..":
+		return true
+	}
+	return false
+}
+
+func checkCall(report *riskReport, args []string) {
+	args = unwrap(args)
+	if len(args) == 0 {
+		return
+	}
+	name := path.Base(args[0])
+	rest := args[1:]
+
+	switch {
+	case shells[name]:
+		if script, ok := shellScript(rest); ok {
+			report.merge(analyzeRisk(script))
+		}
+	case name == "eval":
+		report.merge(analyzeRisk(strings.Join(rest, " ")))
+	case name == "rm":
+		recursive := hasFlag(rest, 'r', "--recursive") || hasFlag(rest, 'R')
+		force := hasFlag(rest, 'f', "--force")
+		for _, t := range operands(rest) {
+			if recursive && isRootLike(t) {
+				report.flag(riskDestructive, "rm -r on "+t)
+			}
+		}
+		switch {
+		case recursive && force:
+			report.flag(riskDestructive, "rm -rf deletes recursively without confirmation")
+		case recursive:
+			report.flag(riskCaution, "rm -r deletes recursively")
+		default:
+			report.flag(riskCaution, "rm deletes files")
+		}
+	case name == "dd":
+		for _, a := range rest {
+			if strings.HasPrefix(a, "of=") {
+				reason := "dd writes raw data to " + strings.TrimPrefix(a, "of=")
+				report.flag(riskDestructive, reason)
+			}
+		}
+	case diskTools[name] || strings.HasPrefix(name, "mkfs."):
+		report.flag(riskDestructive, name+" modifies disks or partitions")
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		recursive := hasFlag(rest, 'R', "--recursive")
+		targets := operands(rest)
+		for _, t := range targets {
+			if recursive && strings.Trim(t, "/*") == "" {
+				report.flag(riskDestructive, name+" -R on "+t)
+			}
+		}
+		if name == "chmod" && len(targets) > 0 && strings.HasSuffix(targets[0], "777") {
+			if recursive {
+				report.flag(riskDestructive, "chmod -R 777 makes everything world-writable")
+			} else {
+				report.flag(riskCaution, "chmod 777 makes files world-writable")
+			}
+		}
+	case name == "git" && len(rest) > 0:
+		switch rest[0] {
+		case "push":
+			if hasFlag(rest[1:], 'f', "--force", "--mirror") || hasPlusRefspec(rest[1:]) {
+				report.flag(riskDestructive, "git force push rewrites remote history")
+			} else if hasFlagPrefix(rest[1:], "--force-with-lease") {
+				report.flag(riskCaution, "git push --force-with-lease rewrites remote history")
+			}
+		case "reset":
+			if hasFlag(rest[1:], 0, "--hard") {
+				report.flag(riskCaution, "git reset --hard discards local changes")
+			}
+		case "clean":
+			if hasFlag(rest[1:], 'f', "--force") {
+				report.flag(riskCaution, "git clean deletes untracked files")
+			}
+		}
+	case name == "find" && hasFlag(rest, 0, "-delete"):
+		report.flag(riskCaution, "find -delete removes matching files")
+	}
+}
+
+// shellScript returns the script passed to a shell with -c, also when the
+// flag is combined with others as in bash -lc.
+func shellScript(args []string) (string, bool) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-o" || a == "+o":
+			i++ // the option name
+		case len(a) < 2 || a[0] != '-' && a[0] != '+' || a == "--":
+			return "", false
+		case a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], 'c') >= 0:
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func hasFlagPrefix(args []string, prefix string) bool {
+	for _, a := range args {
+		if strings.HasPrefix(a, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPlusRefspec(args []string) bool {
+	for _, a := range operands(args) {
+		if strings.HasPrefix(a, "+") {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRedirect(report *riskReport, r *syntax.Redirect) {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+	default:
+		return
+	}
+	if r.Word == nil {
+		return
+	}
+	target := wordText(r.Word)
+	for _, prefix := range blockDevPrefixes {
+		if strings.HasPrefix(target, prefix) {
+			report.flag(riskDestructive, "writes directly to block device "+target)
+			return
+		}
+	}
+}
+
+// downloads reports whether node runs a downloader such as curl, also
+// inside command and process substitutions.
+func downloads(node syntax.Node) bool {
+	found := false
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			if args := unwrap(callArgs(call)); len(args) > 0 && downloaders[path.Base(args[0])] {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// checkSubstScript flags shells and eval running what a substitution
+// downloads, as in sh -c "$(curl ...)" or bash <(curl ...). The script
+// text itself is only "$" to the rest of the analyzer.
+func checkSubstScript(report *riskReport, call *syntax.CallExpr) {
+	all := callArgs(call)
+	args := unwrap(all)
+	if len(args) == 0 {
+		return
+	}
+	name := path.Base(args[0])
+	if !shells[name] && name != "eval" && name != "source" && name != "." {
+		return
+	}
+	for _, w := range call.Args[len(all)-len(args)+1:] {
+		if downloads(w) {
+			report.flag(riskDestructive, name+" runs a downloaded script")
+			return
+		}
+	}
+}
+
+func checkPipe(report *riskReport, bin *syntax.BinaryCmd) {
+	if !downloads(bin.X) {
+		return
+	}
+	if call, ok := bin.Y.Cmd.(*syntax.CallExpr); ok {
+		if args := unwrap(callArgs(call)); len(args) > 0 && shellInterpreters[path.Base(args[0])] {
+			report.flag(riskDestructive, "pipes a download straight into "+path.Base(args[0]))
+		}
+	}
+}
+
+func callsItself(fn *syntax.FuncDecl) bool {
+	found := false
+	syntax.Walk(fn.Body, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			if args := callArgs(call); len(args) > 0 && args[0] == fn.Name.Value {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+const (
+	confirmWord = "yes"
+	helpConfirm = "type yes + enter: run anyway • esc: cancel"
+)
+
+func (g glyphSet) riskBadge(level riskLevel) string {
+	switch level {
+	case riskDestructive:
+		return g.warn + " destructive "
+	case riskCaution:
+		return g.warn + " caution "
+	}
+	return ""
+}
+
+func (t uiTheme) riskStyle(level riskLevel) lipgloss.Style {
+	if level == riskDestructive {
+		return t.fg(t.failure).Bold(true)
+	}
+	return t.fg(t.warning).Bold(true)
+}
+
+// riskOf analyzes value once and caches the report for rendering.
+func (m model) riskOf(value string) riskReport {
+	if r, ok := m.risks[value]; ok {
+		return r
+	}
+	r := analyzeRisk(value)
+	if m.risks != nil {
+		m.risks[value] = r
+	}
+	return r
+}
+
+// optionRisk combines the analyzer's report with the option's declared risk.
+func (m model) optionRisk(opt optionEntry) riskReport {
+	return m.riskOf(opt.Value).withDeclared(opt.Risk)
+}
+
+// runChecked executes the option, asking for a typed confirmation first when
+// it looks destructive and -allow-dangerous was not given.
+func (m model) runChecked(opt optionEntry) (tea.Model, tea.Cmd) {
+	value := opt.Value
+	if r := m.optionRisk(opt); r.level == riskDestructive && !m.cfg.allowDangerous {
+		input := textinput.New()
+		input.Placeholder = confirmWord
+		input.Prompt = "Type " + confirmWord + " to run: "
+		input.CharLimit = 16
+		input.Focus()
+		m.confirmInput = input
+		m.confirmCommand = value
+		m.confirmRisk = r
+		m.mode = modeConfirm
+		m.running = false
+		m.status = helpConfirm
+		return m, textinput.Blink
+	}
+
+	m.status = fmt.Sprintf("running: %s", cleanText(value))
+	m.execOutput = ""
+	m.recordHistory(value, actionExecuted)
+	return m.execute(value)
+}
+
+func (m model) handleConfirmKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case msg.String() == "esc":
+		m.mode = modeViewing
+		m.confirmCommand = ""
+		m.editedFrom = ""
+		m.status = "cancelled • " + m.helpViewing()
+		return m, nil
+	case msg.Type == tea.KeyEnter:
+		if !strings.EqualFold(strings.TrimSpace(m.confirmInput.Value()), confirmWord) {
+			m.confirmInput.SetValue("")
+			m.status = "confirmation did not match • " + helpConfirm
+			return m, nil
+		}
+		value := m.confirmCommand
+		m.mode = modeViewing
+		m.confirmCommand = ""
+		m.status = fmt.Sprintf("running: %s", cleanText(value))
+		m.execOutput = ""
+		m.recordHistory(value, actionExecuted)
+		return m.execute(value)
+	}
+
+	var cmd tea.Cmd
+	m.confirmInput, cmd = m.confirmInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) renderConfirm() string {
+	warnStyle := m.theme.fg(m.theme.failure).Bold(true)
+	reasonStyle := m.theme.fg(m.theme.failure)
+	commandStyle := m.theme.fg(m.theme.text).Bold(true)
+
+	var b strings.Builder
+	b.WriteString(warnStyle.Render(m.theme.glyphs.warn + " This command looks destructive:"))
+	b.WriteString("\n")
+	b.WriteString(commandStyle.Render("  " + cleanText(m.confirmCommand)))
+	b.WriteString("\n")
+	for _, reason := range m.confirmRisk.reasons {
+		b.WriteString(reasonStyle.Render("  " + m.theme.glyphs.item + " " + reason))
+		b.WriteString("\n")
+	}
+	b.WriteString(m.confirmInput.View())
+	b.WriteString("\n")
+	return b.String()
+}
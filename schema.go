@@ -4,3 +4,6 @@ import _ "embed"
 
 //go:embed options.schema.json
 var embeddedSchema []byte
+
+//go:embed explain.schema.json
+var embeddedExplainSchema []byte
@@ -0,0 +1,247 @@
+package instassist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	sessionsFileName = "sessions.json"
+	sessionsMax      = 200
+)
+
+// sessionRecord is a provider session saved after every answered turn so
+// it can be listed with `inst sessions` and reopened with -resume or
+// continued with -session.
+type sessionRecord struct {
+	ID       string        `json:"id"`
+	Provider string        `json:"provider"`
+	Prompts  []string      `json:"prompts"`
+	Options  []optionEntry `json:"options,omitempty"`
+	Cwd      string        `json:"cwd"`
+	Time     time.Time     `json:"time"`
+}
+
+func sessionsPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionsFileName), nil
+}
+
+// loadSessions returns the stored sessions, oldest first. A missing file
+// is not an error.
+func loadSessions() ([]sessionRecord, error) {
+	path, err := sessionsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []sessionRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+// saveSession stores rec, replacing an earlier record of the same provider
+// session, and keeps the sessionsMax most recent ones. The file is replaced
+// atomically so concurrent invocations cannot leave it half written.
+func saveSession(rec sessionRecord) error {
+	records, err := loadSessions()
+	if err != nil {
+		return err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		if r.ID != rec.ID || r.Provider != rec.Provider {
+			kept = append(kept, r)
+		}
+	}
+	records = append(kept, rec)
+	if len(records) > sessionsMax {
+		records = records[len(records)-sessionsMax:]
+	}
+
+	path, err := sessionsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), sessionsFileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lookupSession finds a stored session by "last", its ID or an unambiguous
+// prefix of it.
+func lookupSession(records []sessionRecord, ref string) (sessionRecord, error) {
+	if len(records) == 0 {
+		return sessionRecord{}, fmt.Errorf("no stored sessions")
+	}
+	if ref == "last" {
+		return records[len(records)-1], nil
+	}
+	var matches []sessionRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ID == ref {
+			return records[i], nil
+		}
+		if strings.HasPrefix(records[i].ID, ref) {
+			matches = append(matches, records[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return sessionRecord{}, fmt.Errorf("no stored session %q (see inst sessions)", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return sessionRecord{}, fmt.Errorf("session prefix %q is ambiguous: %d sessions match", ref, len(matches))
+}
+
+// since formats the time elapsed since t the short way: 5m, 3h, 2d.
+func since(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// writeSessions lists records newest first with the first prompt of each.
+func writeSessions(w io.Writer, records []sessionRecord, now time.Time) {
+	sorted := append([]sessionRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.After(sorted[j].Time)
+	})
+	idWidth, providerWidth := len("ID"), len("PROVIDER")
+	for _, r := range sorted {
+		idWidth = max(idWidth, len(r.ID))
+		providerWidth = max(providerWidth, len(r.Provider))
+	}
+	home, _ := os.UserHomeDir()
+	fmt.Fprintf(w, "%-*s  %-*s  %4s  %5s  %-24s  %s\n", idWidth, "ID", providerWidth, "PROVIDER", "AGE", "TURNS", "CWD", "PROMPT")
+	for _, r := range sorted {
+		cwd := r.Cwd
+		if home != "" && strings.HasPrefix(cwd, home) {
+			cwd = "~" + strings.TrimPrefix(cwd, home)
+		}
+		prompt := ""
+		if len(r.Prompts) > 0 {
+			prompt = cleanText(r.Prompts[0])
+		}
+		fmt.Fprintf(w, "%-*s  %-*s  %4s  %5d  %-24s  %s\n", idWidth, r.ID, providerWidth, r.Provider, since(r.Time, now), len(r.Prompts),
+			runewidth.Truncate(cwd, 24, "…"), runewidth.Truncate(prompt, 60, "…"))
+	}
+}
+
+// runSessionsCommand implements `inst sessions`.
+func runSessionsCommand(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: inst sessions")
+		os.Exit(2)
+	}
+	records, err := loadSessions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sessions error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(records) == 0 {
+		fmt.Println("no stored sessions yet")
+		return
+	}
+	writeSessions(os.Stdout, records, time.Now())
+}
+
+// saveCurrentSession stores the session of cli with the prompt chain and
+// options on screen. Like history it is best-effort.
+func (m model) saveCurrentSession(cli string) {
+	id := m.sessionIDs[cli]
+	if id == "" || len(m.promptHistory) == 0 {
+		return
+	}
+	cwd, _ := os.Getwd()
+	_ = saveSession(sessionRecord{
+		ID:       id,
+		Provider: cli,
+		Prompts:  m.promptHistory,
+		Options:  m.options,
+		Cwd:      cwd,
+		Time:     time.Now(),
+	})
+}
+
+// resumeSession reopens a stored session with its prompts and options, so
+// it can be refined with a or used right away.
+func (m model) resumeSession(ref string) (model, error) {
+	records, err := loadSessions()
+	if err != nil {
+		return m, err
+	}
+	rec, err := lookupSession(records, ref)
+	if err != nil {
+		return m, err
+	}
+	found := false
+	for i, p := range m.providers {
+		if p.name() == rec.Provider {
+			m.cliIndex = i
+			found = true
+		}
+	}
+	if !found {
+		return m, fmt.Errorf("session %s: provider %s is not available", rec.ID, rec.Provider)
+	}
+	m.sessionIDs[rec.Provider] = rec.ID
+	m.promptHistory = rec.Prompts
+	if len(rec.Prompts) > 0 {
+		m.lastPrompt = rec.Prompts[len(rec.Prompts)-1]
+	}
+	m.options = rec.Options
+	m.selected = 0
+	m.compare = false
+	m.mode = modeViewing
+	m.input.Blur()
+	m.status = fmt.Sprintf("resumed %s session %s • %s", rec.Provider, rec.ID, m.helpViewing())
+	return m, nil
+}
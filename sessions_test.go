@@ -0,0 +1,75 @@
+package instassist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveSessionReplacesSameSession(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	first := sessionRecord{ID: "abc-1", Provider: "codex", Prompts: []string{"list files"}, Time: time.Now()}
+	if err := saveSession(first); err != nil {
+		t.Fatalf("saveSession: %v", err)
+	}
+	if err := saveSession(sessionRecord{ID: "def-2", Provider: "claude", Prompts: []string{"disk usage"}, Time: time.Now()}); err != nil {
+		t.Fatalf("saveSession: %v", err)
+	}
+	first.Prompts = append(first.Prompts, "only go files")
+	first.Options = []optionEntry{{Value: "ls *.go", Providers: []string{"codex"}}}
+	if err := saveSession(first); err != nil {
+		t.Fatalf("saveSession: %v", err)
+	}
+
+	records, err := loadSessions()
+	if err != nil {
+		t.Fatalf("loadSessions: %v", err)
+	}
+	if len(records) != 2 || records[1].ID != "abc-1" || len(records[1].Prompts) != 2 {
+		t.Fatalf("expected the updated session to move to the end, got %+v", records)
+	}
+	if opts := records[1].Options; len(opts) != 1 || opts[0].Value != "ls *.go" || len(opts[0].Providers) != 1 {
+		t.Fatalf("expected options to round-trip, got %+v", opts)
+	}
+}
+
+func TestLookupSession(t *testing.T) {
+	records := []sessionRecord{{ID: "abc-1"}, {ID: "abd-2"}, {ID: "xyz-3"}}
+	for ref, want := range map[string]string{"last": "xyz-3", "abc-1": "abc-1", "abd": "abd-2", "x": "xyz-3"} {
+		rec, err := lookupSession(records, ref)
+		if err != nil || rec.ID != want {
+			t.Fatalf("lookupSession(%q) = %q, %v; want %q", ref, rec.ID, err, want)
+		}
+	}
+	for _, ref := range []string{"ab", "nope"} {
+		if _, err := lookupSession(records, ref); err == nil {
+			t.Fatalf("expected an error for %q", ref)
+		}
+	}
+	if _, err := lookupSession(nil, "last"); err == nil {
+		t.Fatalf("expected an error without sessions")
+	}
+}
+
+func TestWriteSessionsNewestFirst(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	records := []sessionRecord{
+		{ID: "old", Provider: "codex", Prompts: []string{"first\nprompt"}, Time: now.Add(-50 * time.Hour)},
+		{ID: "new", Provider: "claude", Prompts: []string{"second", "refined"}, Time: now.Add(-5 * time.Minute)},
+	}
+	var buf bytes.Buffer
+	writeSessions(&buf, records, now)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "new ") || !strings.HasPrefix(lines[2], "old ") {
+		t.Fatalf("expected newest first, got:\n%s", buf.String())
+	}
+	for _, want := range []string{"5m", "2", "second"} {
+		if !strings.Contains(lines[1], want) {
+			t.Fatalf("expected %q in %q", want, lines[1])
+		}
+	}
+	if !strings.Contains(lines[2], "2d") || !strings.Contains(lines[2], "first prompt") {
+		t.Fatalf("unexpected line %q", lines[2])
+	}
+}
@@ -0,0 +1,102 @@
+package instassist
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Shell widgets printed by `inst init <shell>`. Each binds Ctrl+G to open
+// the TUI with the current command line as the prompt and replaces the line
+// with the chosen command. The TUI draws on the tty while the selection
+// comes back on fd 3, which the widget captures. The line is passed even
+// when empty, so -prefill never swallows the flag after it.
+const (
+	zshWidget = `# insta-assist: Ctrl+G turns the command line into a prompt.
+# Add to ~/.zshrc: eval "$(inst init zsh)"
+_inst_widget() {
+  local selected
+  selected=$(inst -prefill "$BUFFER" -output fd:3 3>&1 1>/dev/tty 2>/dev/tty </dev/tty)
+  if [[ -n $selected ]]; then
+    BUFFER=$selected
+    CURSOR=${#BUFFER}
+  fi
+  zle reset-prompt
+}
+zle -N _inst_widget
+bindkey '^G' _inst_widget
+`
+
+	bashWidget = `# insta-assist: Ctrl+G turns the command line into a prompt.
+# Add to ~/.bashrc: eval "$(inst init bash)"
+_inst_widget() {
+  local selected
+  selected=$(inst -prefill "$READLINE_LINE" -output fd:3 3>&1 1>/dev/tty 2>/dev/tty </dev/tty)
+  if [[ -n $selected ]]; then
+    READLINE_LINE=$selected
+    READLINE_POINT=${#selected}
+  fi
+}
+bind -x '"\C-g": _inst_widget'
+`
+
+	fishWidget = `# insta-assist: Ctrl+G turns the command line into a prompt.
+# Add to ~/.config/fish/config.fish: inst init fish | source
+function _inst_widget
+    set -l selected (inst -prefill (commandline | string collect --allow-empty) -output fd:3 3>&1 1>/dev/tty 2>/dev/tty </dev/tty | string collect)
+    if test -n "$selected"
+        commandline -r -- $selected
+    end
+    commandline -f repaint
+end
+bind \cg _inst_widget
+`
+)
+
+var shellWidgets = map[string]string{
+	"zsh":  zshWidget,
+	"bash": bashWidget,
+	"fish": fishWidget,
+}
+
+func runInitCommand(args []string) {
+	if len(args) != 1 || shellWidgets[args[0]] == "" {
+		fmt.Fprintln(os.Stderr, "usage: inst init zsh|bash|fish")
+		os.Exit(2)
+	}
+	fmt.Print(shellWidgets[args[0]])
+}
+
+// parseFDOutput reports the file descriptor of an "fd:N" output mode.
+func parseFDOutput(mode string) (int, bool) {
+	n, ok := strings.CutPrefix(mode, "fd:")
+	if !ok {
+		return 0, false
+	}
+	fd, err := strconv.Atoi(n)
+	if err != nil || fd < 1 {
+		return 0, false
+	}
+	return fd, true
+}
+
+// validOutputMode accepts the named output modes and fd:N.
+func validOutputMode(mode string) bool {
+	_, isFD := parseFDOutput(mode)
+	return isFD || containsFold(outputModes, mode)
+}
+
+// writeToFD writes value to an already open file descriptor, such as the
+// one a shell widget redirects with 3>&1.
+func writeToFD(fd int, value string) error {
+	f := os.NewFile(uintptr(fd), "fd:"+strconv.Itoa(fd))
+	if f == nil {
+		return fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(value); err != nil {
+		return fmt.Errorf("writing to fd %d: %w", fd, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package instassist
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestValidOutputMode(t *testing.T) {
+	for mode, want := range map[string]bool{"stdout": true, "JSON": true, "fd:3": true, "fd:0": false, "fd:x": false, "fd": false, "file": false} {
+		if got := validOutputMode(mode); got != want {
+			t.Errorf("validOutputMode(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestShellWidgetsAlwaysPassPrefill(t *testing.T) {
+	// An empty command line must still give -prefill a value, or it takes
+	// -output as its argument and the selection never reaches fd 3.
+	for shell, arg := range map[string]string{
+		"zsh":  `-prefill "$BUFFER" -output fd:3`,
+		"bash": `-prefill "$READLINE_LINE" -output fd:3`,
+		"fish": `-prefill (commandline | string collect --allow-empty) -output fd:3`,
+	} {
+		if !strings.Contains(shellWidgets[shell], "inst "+arg) {
+			t.Errorf("expected the %s widget to run inst %s, got:\n%s", shell, arg, shellWidgets[shell])
+		}
+	}
+}
+
+func TestWriteToFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// writeToFD closes the descriptor it is given, so hand it a duplicate.
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := writeToFD(fd, "git status"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if string(got) != "git status" {
+		t.Fatalf("read %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package instassist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// lineWriter is an io.Writer that calls fn for every complete line written
+// to it. flush delivers a trailing line that has no newline.
+type lineWriter struct {
+	fn      func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.fn(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// streamEvent is the progress carried by one line of a provider's JSONL
+// output: what the agent is doing and the tokens reported so far.
+type streamEvent struct {
+	activity string
+	tokens   int
+}
+
+// parseStreamEvent understands the event streams of codex --json, claude
+// stream-json and opencode --format json. Lines that are not JSON objects
+// report ok=false.
+func parseStreamEvent(line string) (streamEvent, bool) {
+	var v map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &v); err != nil {
+		return streamEvent{}, false
+	}
+	ev := streamEvent{tokens: usageTokens(v)}
+	typ, _ := v["type"].(string)
+	if item, ok := v["item"].(map[string]any); ok {
+		ev.activity = itemActivity(item)
+		return ev, true
+	}
+	if part, ok := v["part"].(map[string]any); ok {
+		if tool, _ := part["tool"].(string); tool != "" {
+			ev.activity = "tool: " + tool
+			return ev, true
+		}
+	}
+	switch typ {
+	case "system", "thread.started":
+		ev.activity = "started"
+	case "turn.started", "step_start":
+		ev.activity = "thinking"
+	case "text":
+		ev.activity = "writing"
+	case "assistant":
+		msg, _ := v["message"].(map[string]any)
+		content, _ := msg["content"].([]any)
+		if len(content) > 0 {
+			block, _ := content[len(content)-1].(map[string]any)
+			ev.activity = itemActivity(block)
+		}
+	}
+	return ev, true
+}
+
+// itemActivity describes a codex item or a claude content block.
+func itemActivity(item map[string]any) string {
+	typ, _ := item["type"].(string)
+	switch typ {
+	case "reasoning", "thinking":
+		return "thinking"
+	case "command_execution":
+		if command, _ := item["command"].(string); command != "" {
+			return "running: " + cleanText(command)
+		}
+		return "running a command"
+	case "tool_use", "mcp_tool_call":
+		for _, key := range []string{"name", "tool"} {
+			if name, _ := item[key].(string); name != "" {
+				return "tool: " + name
+			}
+		}
+		return "using a tool"
+	case "web_search":
+		return "searching the web"
+	case "agent_message", "text":
+		return "writing"
+	}
+	return ""
+}
+
+// usageTokens adds up the input and output tokens of the usage block in an
+// event, wherever the provider puts it.
+func usageTokens(v map[string]any) int {
+	var usage map[string]any
+	if u, ok := v["usage"].(map[string]any); ok {
+		usage = u
+	} else if msg, ok := v["message"].(map[string]any); ok {
+		usage, _ = msg["usage"].(map[string]any)
+	} else if part, ok := v["part"].(map[string]any); ok {
+		usage, _ = part["tokens"].(map[string]any)
+	}
+	total := 0
+	for _, key := range []string{"input_tokens", "output_tokens", "input", "output"} {
+		if n, ok := usage[key].(float64); ok {
+			total += int(n)
+		}
+	}
+	return total
+}
+
+// streamLineMsg is one line of output from the in-flight request. events is
+// the channel to keep reading from.
+type streamLineMsg struct {
+	id     int
+	line   string
+	events <-chan tea.Msg
+}
+
+// waitStream reads the next streamed line; it returns nil once the request
+// has finished and the channel is closed.
+func waitStream(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// handleStreamLine updates the progress shown in the status line and shows
+// options as soon as a line carrying a complete options block arrives.
+func (m model) handleStreamLine(msg streamLineMsg) (tea.Model, tea.Cmd) {
+	if msg.id != m.requestID || !m.running {
+		return m, nil
+	}
+	m.streamRaw += msg.line + "\n"
+	if ev, ok := parseStreamEvent(msg.line); ok {
+		if ev.activity != "" {
+			m.streamActivity = ev.activity
+		}
+		if ev.tokens > 0 {
+			m.streamTokens = ev.tokens
+		}
+	}
+	if len(m.options) == 0 {
+		if opts, err := extractOptions(msg.line); err == nil && len(opts) > 0 {
+			m.options = opts
+			m.selected = 0
+		}
+	}
+	m.status = m.streamStatus()
+	return m, waitStream(msg.events)
+}
+
+func (m model) streamStatus() string {
+	var parts []string
+	if m.streamActivity != "" {
+		parts = append(parts, m.streamActivity)
+	}
+	if m.streamTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", m.streamTokens))
+	}
+	help := helpRunning
+	if len(m.options) > 0 {
+		help = m.helpRunningOptions()
+	}
+	if len(parts) == 0 {
+		return help
+	}
+	return strings.Join(parts, " • ") + " • " + help
+}
+
+// finishEarly stops waiting for the provider once streamed options are on
+// screen, keeping the session so the result can still be refined.
+func (m model) finishEarly() model {
+	m.stopRequest()
+	m.running = false
+	m.mode = modeViewing
+	m.rawOutput = strings.TrimSpace(m.streamRaw)
+	m.captureSession(m.currentCLI().name(), m.rawOutput)
+	m.saveCurrentSession(m.currentCLI().name())
+	m.storeResponse(m.currentCLI().name(), m.options)
+	m.status = m.helpViewing()
+	return m
+}
@@ -0,0 +1,40 @@
+package instassist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineWriterSplitsWrites(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	w.Write([]byte("one\r\ntw"))
+	w.Write([]byte("o\nthree"))
+	w.flush()
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestParseStreamEvent(t *testing.T) {
+	cases := []struct {
+		line string
+		want streamEvent
+	}{
+		{`{"type":"item.started","item":{"type":"command_execution","command":"ls -la"}}`, streamEvent{activity: "running: ls -la"}},
+		{`{"type":"item.completed","item":{"type":"reasoning","text":"..."}}`, streamEvent{activity: "thinking"}},
+		{`{"type":"turn.completed","usage":{"input_tokens":1200,"output_tokens":34}}`, streamEvent{tokens: 1234}},
+		{`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Bash"}],"usage":{"input_tokens":10,"output_tokens":5}}}`, streamEvent{activity: "tool: Bash", tokens: 15}},
+		{`{"type":"tool_use","part":{"tool":"grep"}}`, streamEvent{activity: "tool: grep"}},
+		{`{"type":"step_finish","part":{"tokens":{"input":7,"output":3}}}`, streamEvent{tokens: 10}},
+	}
+	for _, tc := range cases {
+		got, ok := parseStreamEvent(tc.line)
+		if !ok || got != tc.want {
+			t.Errorf("parseStreamEvent(%s) = %+v, %v; want %+v", tc.line, got, ok, tc.want)
+		}
+	}
+	if _, ok := parseStreamEvent("Thinking..."); ok {
+		t.Errorf("plain text should not parse as an event")
+	}
+}
@@ -0,0 +1,464 @@
+package instassist
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// uiTheme holds the colors and symbols the TUI draws with.
+type uiTheme struct {
+	name string
+	dark bool // drawn for a dark terminal background
+
+	accent     lipgloss.TerminalColor // title, keys, selected provider
+	muted      lipgloss.TerminalColor // descriptions, separators, comments
+	text       lipgloss.TerminalColor // commands and options
+	info       lipgloss.TerminalColor // labels, context and cached pills
+	prompt     lipgloss.TerminalColor // prompts sent so far
+	success    lipgloss.TerminalColor
+	warning    lipgloss.TerminalColor
+	failure    lipgloss.TerminalColor
+	selectedFG lipgloss.TerminalColor // selected option
+	selectedBG lipgloss.TerminalColor
+	onAccent   lipgloss.TerminalColor // text on accent and info backgrounds
+	border     lipgloss.TerminalColor // input boxes
+
+	// mono highlights with reverse video instead of background colors.
+	mono bool
+
+	glyphs glyphSet
+}
+
+// builtinThemeNames are the themes that need no config. auto picks dark
+// or light from the terminal background.
+var builtinThemeNames = []string{"auto", "dark", "light", "high-contrast", "monochrome"}
+
+func darkTheme() uiTheme {
+	return uiTheme{
+		name:       "dark",
+		dark:       true,
+		accent:     lipgloss.Color("205"),
+		muted:      lipgloss.Color("250"),
+		text:       lipgloss.Color("15"),
+		info:       lipgloss.Color("14"),
+		prompt:     lipgloss.Color("12"),
+		success:    lipgloss.Color("10"),
+		warning:    lipgloss.Color("11"),
+		failure:    lipgloss.Color("9"),
+		selectedFG: lipgloss.Color("230"),
+		selectedBG: lipgloss.Color("62"),
+		onAccent:   lipgloss.Color("0"),
+		border:     lipgloss.Color("51"),
+	}
+}
+
+func lightTheme() uiTheme {
+	return uiTheme{
+		name:       "light",
+		accent:     lipgloss.Color("162"),
+		muted:      lipgloss.Color("242"),
+		text:       lipgloss.Color("235"),
+		info:       lipgloss.Color("30"),
+		prompt:     lipgloss.Color("25"),
+		success:    lipgloss.Color("28"),
+		warning:    lipgloss.Color("130"),
+		failure:    lipgloss.Color("160"),
+		selectedFG: lipgloss.Color("231"),
+		selectedBG: lipgloss.Color("62"),
+		onAccent:   lipgloss.Color("231"),
+		border:     lipgloss.Color("201"),
+	}
+}
+
+// highContrastTheme sticks to the bright base colors on a dark background
+// and drops the grays.
+func highContrastTheme() uiTheme {
+	return uiTheme{
+		name:       "high-contrast",
+		dark:       true,
+		accent:     lipgloss.Color("11"),
+		muted:      lipgloss.Color("15"),
+		text:       lipgloss.Color("15"),
+		info:       lipgloss.Color("14"),
+		prompt:     lipgloss.Color("14"),
+		success:    lipgloss.Color("10"),
+		warning:    lipgloss.Color("11"),
+		failure:    lipgloss.Color("9"),
+		selectedFG: lipgloss.Color("0"),
+		selectedBG: lipgloss.Color("11"),
+		onAccent:   lipgloss.Color("0"),
+		border:     lipgloss.Color("15"),
+	}
+}
+
+// monochromeTheme uses no colors at all, only bold and reverse video.
+func monochromeTheme() uiTheme {
+	none := lipgloss.NoColor{}
+	return uiTheme{
+		name:       "monochrome",
+		dark:       darkBackground(),
+		accent:     none,
+		muted:      none,
+		text:       none,
+		info:       none,
+		prompt:     none,
+		success:    none,
+		warning:    none,
+		failure:    none,
+		selectedFG: none,
+		selectedBG: none,
+		onAccent:   none,
+		border:     none,
+		mono:       true,
+	}
+}
+
+// baseTheme returns the built-in theme called name. auto, and any other
+// name, picks dark or light from the terminal background.
+func baseTheme(name string) uiTheme {
+	switch name {
+	case "dark":
+		return darkTheme()
+	case "light":
+		return lightTheme()
+	case "high-contrast":
+		return highContrastTheme()
+	case "monochrome":
+		return monochromeTheme()
+	}
+	if darkBackground() {
+		return darkTheme()
+	}
+	return lightTheme()
+}
+
+// darkBackground reports whether the terminal background is dark, from
+// COLORFGBG when the terminal sets it and by asking the terminal otherwise.
+func darkBackground() bool {
+	if v := os.Getenv("COLORFGBG"); v != "" {
+		parts := strings.Split(v, ";")
+		if bg, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+			// 0-6 and 8 are the dark colors of the 16-color palette.
+			return bg <= 6 || bg == 8
+		}
+	}
+	return lipgloss.HasDarkBackground()
+}
+
+// noColor reports whether NO_COLOR (https://no-color.org) is set.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// fg is a style with foreground c.
+func (t uiTheme) fg(c lipgloss.TerminalColor) lipgloss.Style {
+	if c == nil {
+		return lipgloss.NewStyle()
+	}
+	return lipgloss.NewStyle().Foreground(c)
+}
+
+// fill is a style for text on a colored background, such as the selected
+// option or an enabled toggle. Monochrome themes reverse the text instead.
+func (t uiTheme) fill(bg, fg lipgloss.TerminalColor) lipgloss.Style {
+	if t.mono || bg == nil || fg == nil {
+		return lipgloss.NewStyle().Reverse(true)
+	}
+	return lipgloss.NewStyle().Background(bg).Foreground(fg)
+}
+
+// style applies the theme to the prompt textarea, whose default styles
+// carry their own colors.
+func (t uiTheme) style(input *textarea.Model) {
+	if !t.mono {
+		return
+	}
+	plain := textarea.Style{Placeholder: lipgloss.NewStyle().Faint(true)}
+	input.FocusedStyle = plain
+	input.BlurredStyle = plain
+}
+
+// glyphSet holds the symbols drawn around the text. The ASCII set is for
+// terminals and fonts without emoji or box-drawing characters.
+type glyphSet struct {
+	logo      string
+	hint      string
+	loading   string
+	search    string
+	selected  string
+	prompt    string
+	continued string
+	arrow     string
+	ok        string
+	fail      string
+	warn      string
+	done      string
+	failed    string
+	dot       string
+	bullet    string
+	item      string
+	ellipsis  string
+	rule      string
+	scrollUp  string
+	scrollBar string
+	scrollEnd string
+	spinner   []string
+	border    lipgloss.Border
+
+	// ascii also rewrites the symbols of status messages.
+	ascii bool
+}
+
+func unicodeGlyphs() glyphSet {
+	return glyphSet{
+		logo:      "✨",
+		hint:      "💡",
+		loading:   "⏳",
+		search:    "🔎",
+		selected:  "▶",
+		prompt:    "❯",
+		continued: "↳",
+		arrow:     "→",
+		ok:        "✅",
+		fail:      "❌",
+		warn:      "⚠",
+		done:      "✓",
+		failed:    "✗",
+		dot:       "·",
+		bullet:    "•",
+		item:      "•",
+		ellipsis:  "…",
+		rule:      "─",
+		scrollUp:  "▲",
+		scrollBar: "│",
+		scrollEnd: "▼",
+		spinner:   []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"},
+		border:    lipgloss.RoundedBorder(),
+	}
+}
+
+func asciiGlyphs() glyphSet {
+	return glyphSet{
+		logo:      "*",
+		hint:      "-",
+		loading:   "...",
+		search:    "/",
+		selected:  ">",
+		prompt:    ">",
+		continued: "+",
+		arrow:     "->",
+		ok:        "[ok]",
+		fail:      "[x]",
+		warn:      "[!]",
+		done:      "+",
+		failed:    "x",
+		dot:       "-",
+		bullet:    "|",
+		item:      "-",
+		ellipsis:  "...",
+		rule:      "-",
+		scrollUp:  "^",
+		scrollBar: "|",
+		scrollEnd: "v",
+		spinner:   []string{"|", "/", "-", "\\"},
+		border:    lipgloss.ASCIIBorder(),
+		ascii:     true,
+	}
+}
+
+// asciiReplacer maps the Unicode glyphs of status messages to their ASCII
+// forms.
+var asciiReplacer = func() *strings.Replacer {
+	u, a := unicodeGlyphs(), asciiGlyphs()
+	return strings.NewReplacer(
+		u.ok, a.ok, u.fail, a.fail, u.warn, a.warn, u.bullet, a.bullet,
+		u.dot, a.dot, u.ellipsis, a.ellipsis, u.arrow, a.arrow,
+	)
+}()
+
+// text returns s with Unicode symbols replaced in the ASCII set.
+func (g glyphSet) text(s string) string {
+	if !g.ascii {
+		return s
+	}
+	return asciiReplacer.Replace(s)
+}
+
+// spin returns the spinner frame for tick n.
+func (g glyphSet) spin(n int) string {
+	if len(g.spinner) == 0 {
+		return ""
+	}
+	return g.spinner[n%len(g.spinner)]
+}
+
+// unicodeTerminal reports whether the terminal is expected to draw emoji:
+// not the Linux console, and not a locale that names a non-UTF-8 charset.
+func unicodeTerminal() bool {
+	if os.Getenv("TERM") == "linux" {
+		return false
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return true
+}
+
+// themeConfig is a user theme from a [themes.<name>] table: the built-in
+// theme it starts from and the colors it changes, as ANSI numbers (0-255)
+// or #rrggbb.
+type themeConfig struct {
+	Base       string `toml:"base"`
+	Accent     string `toml:"accent"`
+	Muted      string `toml:"muted"`
+	Text       string `toml:"text"`
+	Info       string `toml:"info"`
+	Prompt     string `toml:"prompt"`
+	Success    string `toml:"success"`
+	Warning    string `toml:"warning"`
+	Error      string `toml:"error"`
+	SelectedFG string `toml:"selected_fg"`
+	SelectedBG string `toml:"selected_bg"`
+	OnAccent   string `toml:"on_accent"`
+	Border     string `toml:"border"`
+}
+
+var (
+	themeName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	hexColor  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// themeColor is a color setting of a user theme and the color it sets.
+type themeColor struct {
+	key   string
+	value string
+	color *lipgloss.TerminalColor
+}
+
+func (tc themeConfig) colors(t *uiTheme) []themeColor {
+	return []themeColor{
+		{"accent", tc.Accent, &t.accent},
+		{"muted", tc.Muted, &t.muted},
+		{"text", tc.Text, &t.text},
+		{"info", tc.Info, &t.info},
+		{"prompt", tc.Prompt, &t.prompt},
+		{"success", tc.Success, &t.success},
+		{"warning", tc.Warning, &t.warning},
+		{"error", tc.Error, &t.failure},
+		{"selected_fg", tc.SelectedFG, &t.selectedFG},
+		{"selected_bg", tc.SelectedBG, &t.selectedBG},
+		{"on_accent", tc.OnAccent, &t.onAccent},
+		{"border", tc.Border, &t.border},
+	}
+}
+
+func (tc themeConfig) validate() error {
+	if tc.Base != "" && !containsFold(builtinThemeNames, tc.Base) {
+		return fmt.Errorf("invalid base %q (valid: %s)", tc.Base, strings.Join(builtinThemeNames, ", "))
+	}
+	for _, c := range tc.colors(&uiTheme{}) {
+		if c.value == "" || hexColor.MatchString(c.value) {
+			continue
+		}
+		if n, err := strconv.Atoi(c.value); err != nil || n < 0 || n > 255 {
+			return fmt.Errorf("%s: invalid color %q (use 0-255 or #rrggbb)", c.key, c.value)
+		}
+	}
+	return nil
+}
+
+// apply returns the base theme with the configured colors.
+func (tc themeConfig) apply(name string) uiTheme {
+	t := baseTheme(strings.ToLower(tc.Base))
+	t.name = name
+	for _, c := range tc.colors(&t) {
+		if c.value != "" {
+			*c.color = lipgloss.Color(c.value)
+			// A color turns a monochrome base into a colored theme.
+			t.mono = false
+		}
+	}
+	return t
+}
+
+// userThemeNames lists the themes defined in config, sorted.
+func (cfg config) userThemeNames() []string {
+	names := make([]string, 0, len(cfg.themes))
+	for name := range cfg.themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// themeNames lists the built-in themes and the user themes of cfg.
+func (cfg config) themeNames() []string {
+	return append(append([]string(nil), builtinThemeNames...), cfg.userThemeNames()...)
+}
+
+// setTheme selects the theme called name after checking that it exists.
+func (cfg *config) setTheme(name string) error {
+	name = strings.ToLower(name)
+	if !containsFold(cfg.themeNames(), name) {
+		return fmt.Errorf("invalid theme %q (valid: %s)", name, strings.Join(cfg.themeNames(), ", "))
+	}
+	cfg.theme = name
+	return nil
+}
+
+// addThemes adds the [themes.<name>] tables of a config layer.
+func (cfg *config) addThemes(themes map[string]themeConfig) error {
+	for name, tc := range themes {
+		if !themeName.MatchString(name) {
+			return fmt.Errorf("theme name %q must be lowercase letters, digits, - and _", name)
+		}
+		if containsFold(builtinThemeNames, name) {
+			return fmt.Errorf("theme %q is built in and cannot be redefined", name)
+		}
+		if err := tc.validate(); err != nil {
+			return fmt.Errorf("theme %s: %w", name, err)
+		}
+		if cfg.themes == nil {
+			cfg.themes = map[string]themeConfig{}
+		}
+		cfg.themes[name] = tc
+	}
+	return nil
+}
+
+// resolveTheme builds the theme the TUI draws with. NO_COLOR selects the
+// monochrome theme unless a theme was chosen explicitly, and the ASCII
+// symbols are used when asked for or when the terminal cannot draw emoji.
+func (cfg config) resolveTheme() uiTheme {
+	name := cfg.theme
+	if noColor() && cfg.sources["theme"] == sourceDefault {
+		name = "monochrome"
+	}
+	var t uiTheme
+	if tc, ok := cfg.themes[name]; ok {
+		t = tc.apply(name)
+	} else {
+		t = baseTheme(name)
+	}
+	t.glyphs = cfg.glyphSet()
+	return t
+}
+
+// glyphSet returns the ASCII symbols when ascii is set, or when it is not
+// configured and the terminal cannot draw emoji.
+func (cfg config) glyphSet() glyphSet {
+	if cfg.ascii || (cfg.sources["ascii"] == sourceDefault && !unicodeTerminal()) {
+		return asciiGlyphs()
+	}
+	return unicodeGlyphs()
+}
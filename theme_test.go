@@ -0,0 +1,133 @@
+package instassist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestConfigUserThemes(t *testing.T) {
+	data := `theme = "solarized"
+
+[themes.solarized]
+base = "dark"
+accent = "#b58900"
+text = "230"
+`
+	var layer fileConfig
+	if err := parseConfig(data, &layer); err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	cfg := defaultConfig()
+	if err := cfg.merge(layer, "test"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if cfg.theme != "solarized" || cfg.sources["themes"] != "test" {
+		t.Fatalf("expected the solarized theme from test, got %q (%s)", cfg.theme, cfg.sources["themes"])
+	}
+
+	th := cfg.resolveTheme()
+	if th.accent != lipgloss.Color("#b58900") || th.text != lipgloss.Color("230") {
+		t.Errorf("expected the configured colors, got accent %v text %v", th.accent, th.text)
+	}
+	if th.failure != darkTheme().failure || !th.dark {
+		t.Errorf("expected unset colors to come from the dark base")
+	}
+	if names := cfg.themeNames(); names[len(names)-1] != "solarized" {
+		t.Errorf("expected the user theme in the theme names, got %v", names)
+	}
+}
+
+func TestConfigRejectsInvalidThemes(t *testing.T) {
+	for _, data := range []string{
+		`theme = "neon"`,
+		"[themes.neon]\naccent = \"pink\"\n",
+		"[themes.neon]\naccent = \"256\"\n",
+		"[themes.neon]\nbase = \"solarized\"\n",
+		"[themes.dark]\naccent = \"1\"\n",
+		"[themes.\"Neon Lights\"]\naccent = \"1\"\n",
+	} {
+		var layer fileConfig
+		err := parseConfig(data, &layer)
+		if err == nil {
+			cfg := defaultConfig()
+			err = cfg.merge(layer, "test")
+		}
+		if err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestResolveThemeHonoursNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	cfg := defaultConfig()
+	if th := cfg.resolveTheme(); !th.mono || th.name != "monochrome" {
+		t.Errorf("expected NO_COLOR to select the monochrome theme, got %s", th.name)
+	}
+
+	cfg.theme = "high-contrast"
+	cfg.sources["theme"] = "flag -theme"
+	if th := cfg.resolveTheme(); th.name != "high-contrast" {
+		t.Errorf("expected an explicit theme to win over NO_COLOR, got %s", th.name)
+	}
+
+	if style := monochromeTheme().fill(lipgloss.Color("62"), lipgloss.Color("230")); !style.GetReverse() {
+		t.Errorf("expected monochrome highlights to use reverse video")
+	}
+}
+
+func TestAutoThemeUsesColorFGBG(t *testing.T) {
+	t.Setenv("COLORFGBG", "0;15")
+	if th := baseTheme("auto"); th.name != "light" {
+		t.Errorf("expected a light background to pick the light theme, got %s", th.name)
+	}
+	t.Setenv("COLORFGBG", "15;default;0")
+	if th := baseTheme("auto"); th.name != "dark" {
+		t.Errorf("expected a dark background to pick the dark theme, got %s", th.name)
+	}
+}
+
+func TestGlyphSetSelection(t *testing.T) {
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_CTYPE", "")
+	t.Setenv("LANG", "en_US.UTF-8")
+	cfg := defaultConfig()
+	if cfg.glyphSet().ascii {
+		t.Errorf("expected Unicode symbols in a UTF-8 terminal")
+	}
+
+	t.Setenv("LANG", "C")
+	if !cfg.glyphSet().ascii {
+		t.Errorf("expected ASCII symbols under a non-UTF-8 locale")
+	}
+	cfg.sources["ascii"] = "test"
+	if cfg.glyphSet().ascii {
+		t.Errorf("expected ascii = false to keep Unicode symbols")
+	}
+
+	t.Setenv("LANG", "en_US.UTF-8")
+	t.Setenv("TERM", "linux")
+	if !defaultConfig().glyphSet().ascii {
+		t.Errorf("expected ASCII symbols on the Linux console")
+	}
+}
+
+func TestASCIIGlyphs(t *testing.T) {
+	g := asciiGlyphs()
+	status := "❌ exec failed • f: ask AI to fix • cached · 2m…"
+	if got := g.text(status); got != "[x] exec failed | f: ask AI to fix | cached - 2m..." {
+		t.Errorf("unexpected ASCII status %q", got)
+	}
+	if unicodeGlyphs().text(status) != status {
+		t.Errorf("expected Unicode glyphs to leave the status alone")
+	}
+
+	for _, s := range append([]string{g.logo, g.hint, g.selected, g.prompt, g.ok, g.fail, g.warn, g.riskBadge(riskDestructive)}, g.spinner...) {
+		if strings.IndexFunc(s, func(r rune) bool { return r > 127 }) >= 0 {
+			t.Errorf("expected ASCII only, got %q", s)
+		}
+	}
+}
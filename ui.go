@@ -3,27 +3,27 @@ package instassist
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
-	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/creack/pty"
 	"github.com/mattn/go-runewidth"
 )
 
 const (
 	titleText = "insta-assist"
 
-	grayColor = "250"
-
-	helpInput   = "enter: send • ctrl+r: send & run • ctrl+y: toggle yolo • alt+enter/ctrl+j: newline • esc: exit"
-	helpViewing = "enter: copy & exit • ctrl+r: run & exit • a: refine • n: new prompt • ctrl+y: toggle yolo • esc/q: quit"
-	helpRefine  = "enter: refine • ctrl+r: refine & run • ctrl+y: toggle yolo • alt+enter/ctrl+j: newline • esc: exit"
+	helpRunning = "esc: cancel • ctrl+c: quit"
 )
 
 type viewMode int
@@ -33,18 +33,28 @@ const (
 	modeRunning
 	modeViewing
 	modeRefine
+	modeHistory
+	modeConfirm
+	modeParams
+	modeEdit
+	modePreview
+	modeExec
+	modeExplain
+	modeHelp
 )
 
 type responseMsg struct {
+	id     int // requestID it answers; stale IDs are dropped
 	output []byte
 	err    error
 	cli    string
 }
 
 type execResultMsg struct {
-	err    error
-	exit   bool
-	output string
+	err     error
+	exit    bool
+	output  string
+	command string
 }
 
 type tickMsg struct{}
@@ -63,20 +73,26 @@ type clickRegion struct {
 }
 
 type headerMeta struct {
-	cliRegions  []clickRegion
-	yoloRegion  clickRegion
-	headerWidth int
-}
-
-type cliOption struct {
-	name         string
-	runPrompt    func(ctx context.Context, prompt string, yolo bool) ([]byte, error)
-	resumePrompt func(ctx context.Context, prompt string, sessionID string, yolo bool) ([]byte, error)
+	cliRegions    []clickRegion
+	modeRegion    clickRegion
+	yoloRegion    clickRegion
+	contextRegion clickRegion
+	headerWidth   int
 }
 
 type model struct {
-	cliOptions []cliOption
-	cliIndex   int
+	providers []provider
+	cliIndex  int
+	schema    schemaSpec
+	cfg       config
+	keys      keyMap
+	theme     uiTheme
+
+	// Prompt mode (ctrl+t or -mode): an index into cfg.modes, -1 for none.
+	// schema is baseSchema extended with the mode's fields.
+	modeIndex   int
+	baseSchema  schemaSpec
+	modeSchemas map[string]schemaSpec
 
 	input textarea.Model
 
@@ -102,105 +118,109 @@ type model struct {
 
 	autoExecute bool // if true, execute first result and exit
 
+	startup tea.Cmd // run when the program starts, e.g. the request of `inst fix`
+
 	spinnerFrame int // for animation while waiting
 
-	sessionIDs      map[string]string
+	// The in-flight provider request. requestID grows with every request
+	// and cancellation so late responses can be told apart.
+	requestID     int
+	cancelRequest context.CancelFunc
+
+	// Output streamed so far by the in-flight request and the progress it
+	// reported.
+	streamRaw      string
+	streamActivity string
+	streamTokens   int
+
+	// Compare mode (ctrl+a or -cli a,b) sends new prompts to several
+	// providers at once. compareCLIs limits it to the named providers.
+	compare        bool
+	compareCLIs    []string
+	compareState   map[string]string // provider name -> running, done or failed
+	compareResults map[string][]optionEntry
+	compareErrors  []error
+	comparePending int
+
+	sessionIDs map[string]string
+	// pendingResumeID is the session a refine resumes, kept while it runs
+	// so a cancelled refine can be sent again.
 	pendingResumeID string
 	promptHistory   []string
+
+	// The last new prompt sent (r sends it again past the cache), the
+	// response cache key of the in-flight request, and when the options on
+	// screen were cached if they came from the cache.
+	requestContent string
+	cacheKey       string
+	cachedAt       time.Time
+
+	// Persistent history (history.jsonl) and its recall state.
+	history         []historyEntry
+	historyIndex    int    // position while cycling with up/down, -1 when not cycling
+	historyDraft    string // input saved before cycling started
+	historyQuery    textinput.Model
+	historyMatches  []historyEntry
+	historySelected int
+	historyReturn   viewMode
+
+	// Risk analysis cache keyed by option value, and the pending
+	// confirmation before running a destructive command.
+	risks          map[string]riskReport
+	confirmInput   textinput.Model
+	confirmCommand string
+	confirmRisk    riskReport
+
+	// PATH lookups for the binaries options declare in "requires".
+	binaries map[string]bool
+
+	// Parameter form for options with {{name}} placeholders.
+	paramOption optionEntry
+	paramDefs   []optionParam
+	paramInputs []textinput.Model
+	paramFocus  int
+	paramAction string
+
+	// Editing the selected command (e / E) before using it. editedFrom holds
+	// the original command until the edit is recorded in history.
+	editSource optionEntry
+	editInput  textarea.Model
+	editedFrom string
+
+	// Stay-open command running in a PTY, and its scrollable output.
+	execRun  *ptyRun
+	execView viewport.Model
+	execSeq  int
+
+	// Explanations of commands (x), keyed by command, and the one on screen.
+	explanations   map[string]explanation
+	explainCommand string
+	explainErr     error
+	explainView    viewport.Model
+
+	// The last command that exited unsuccessfully, for the f key.
+	lastFailure *failedRun
+
+	// Environment context added to new prompts, and the prompt preview.
+	env           envInfo
+	useContext    bool
+	preview       string
+	previewReturn viewMode
+
+	// The ? overlay listing the keymap, and what it returns to.
+	helpReturn viewMode
+	helpStatus string
 }
 
-func newModel(defaultCLI string, stayOpenExec bool, yoloDefault bool) model {
+func newModel(allProviders []provider, cfg config) model {
 	schemaPath, schemaJSON, err := schemaSources()
 	if err != nil {
 		logFatalSchema(err)
 	}
 
-	allCLIOptions := []cliOption{
-		{
-			name: "codex",
-			runPrompt: func(ctx context.Context, prompt string, yolo bool) ([]byte, error) {
-				args := []string{"exec"}
-				if yolo {
-					args = append(args, "--yolo")
-				}
-				args = append(args, "--output-schema", schemaPath, "--skip-git-repo-check", "--json")
-				cmd := exec.CommandContext(ctx, "codex", args...)
-				cmd.Stdin = strings.NewReader(prompt)
-				return cmd.CombinedOutput()
-			},
-			resumePrompt: func(ctx context.Context, prompt string, sessionID string, yolo bool) ([]byte, error) {
-				args := []string{"exec"}
-				if yolo {
-					args = append(args, "--yolo")
-				}
-				args = append(args, "--output-schema", schemaPath, "--skip-git-repo-check", "--json", "resume", sessionID, "-")
-				cmd := exec.CommandContext(ctx, "codex", args...)
-				cmd.Stdin = strings.NewReader(prompt)
-				return cmd.CombinedOutput()
-			},
-		},
-		{
-			name: "claude",
-			runPrompt: func(ctx context.Context, prompt string, yolo bool) ([]byte, error) {
-				args := []string{"-p", prompt, "--print", "--output-format", "json", "--json-schema", schemaJSON}
-				if yolo {
-					args = append(args, "--dangerously-skip-permissions")
-				}
-				cmd := exec.CommandContext(ctx, "claude", args...)
-				return cmd.CombinedOutput()
-			},
-			resumePrompt: func(ctx context.Context, prompt string, sessionID string, yolo bool) ([]byte, error) {
-				args := []string{"-p", prompt, "--print", "--output-format", "json", "--json-schema", schemaJSON, "--resume", sessionID}
-				if yolo {
-					args = append(args, "--dangerously-skip-permissions")
-				}
-				cmd := exec.CommandContext(ctx, "claude", args...)
-				return cmd.CombinedOutput()
-			},
-		},
-		{
-			name: "gemini",
-			runPrompt: func(ctx context.Context, prompt string, yolo bool) ([]byte, error) {
-				args := []string{"--output-format", "json"}
-				if yolo {
-					args = append(args, "--yolo")
-				}
-				args = append(args, prompt)
-				cmd := exec.CommandContext(ctx, "gemini", args...)
-				return cmd.CombinedOutput()
-			},
-			resumePrompt: func(ctx context.Context, prompt string, sessionID string, yolo bool) ([]byte, error) {
-				args := []string{"--output-format", "json", "--resume", sessionID}
-				if yolo {
-					args = append(args, "--yolo")
-				}
-				args = append(args, prompt)
-				cmd := exec.CommandContext(ctx, "gemini", args...)
-				return cmd.CombinedOutput()
-			},
-		},
-		{
-			name: "opencode",
-			runPrompt: func(ctx context.Context, prompt string, yolo bool) ([]byte, error) {
-				cmd := exec.CommandContext(ctx, "opencode", "run", "--format", "json", prompt)
-				return cmd.CombinedOutput()
-			},
-			resumePrompt: func(ctx context.Context, prompt string, sessionID string, yolo bool) ([]byte, error) {
-				cmd := exec.CommandContext(ctx, "opencode", "run", "--format", "json", "--session", sessionID, prompt)
-				return cmd.CombinedOutput()
-			},
-		},
-	}
-
-	var cliOptions []cliOption
-	for _, opt := range allCLIOptions {
-		if cliAvailable(opt.name) {
-			cliOptions = append(cliOptions, opt)
-		}
-	}
-
-	if len(cliOptions) == 0 {
-		logFatalSchema(fmt.Errorf("no AI CLIs found. Please install at least one of: codex, claude, gemini, opencode"))
+	providers := availableProviders(allProviders)
+	if len(providers) == 0 {
+		logFatalSchema(fmt.Errorf("no AI providers available. Install a CLI or configure an API backend: %s", strings.Join(providerNames(allProviders), ", ")))
 	}
 
 	input := textarea.New()
@@ -210,29 +230,60 @@ func newModel(defaultCLI string, stayOpenExec bool, yoloDefault bool) model {
 	input.Prompt = ""
 	input.ShowLineNumbers = false
 	input.SetHeight(1) // Start with 1 line, will expand dynamically
+	theme := cfg.resolveTheme()
+	theme.style(&input)
+
+	// History is best-effort; a missing or unreadable file starts empty.
+	history, _ := loadHistory()
 
 	cliIndex := 0
-	for i, opt := range cliOptions {
-		if strings.EqualFold(opt.name, defaultCLI) {
+	for i, p := range providers {
+		if strings.EqualFold(p.name(), cfg.defaultCLI) {
 			cliIndex = i
 			break
 		}
 	}
 
-	return model{
-		cliOptions:   cliOptions,
+	schema := schemaSpec{path: schemaPath, json: schemaJSON}
+	m := model{
+		providers:    providers,
 		cliIndex:     cliIndex,
+		schema:       schema,
+		baseSchema:   schema,
+		modeIndex:    -1,
+		modeSchemas:  map[string]schemaSpec{},
 		input:        input,
 		mode:         modeInput,
-		status:       helpInput,
-		stayOpenExec: stayOpenExec,
-		yolo:         yoloDefault,
+		stayOpenExec: cfg.stayOpenExec,
+		yolo:         cfg.yolo,
+		cfg:          cfg,
+		keys:         cfg.keys,
+		theme:        theme,
+		compare:      len(cfg.compareCLIs) > 1,
+		compareCLIs:  cfg.compareCLIs,
 		sessionIDs:   map[string]string{},
+		history:      history,
+		historyIndex: -1,
+		risks:        map[string]riskReport{},
+		binaries:     map[string]bool{},
+		explanations: map[string]explanation{},
+		env:          gatherEnv(),
+		useContext:   cfg.context,
+	}
+	m.status = m.helpInput()
+	for i, pm := range cfg.modes {
+		if pm.Name == cfg.mode {
+			m.selectMode(i, false)
+		}
+	}
+	if conflicts := m.keys.conflicts(); len(conflicts) > 0 {
+		m.status = m.theme.glyphs.warn + " key conflict: " + strings.Join(conflicts, "; ") + " • " + m.status
 	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return nil
+	return m.startup
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -243,6 +294,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.ready = true
 		m.resizeComponents()
 		m.adjustTextareaHeight()
+		if m.mode == modeExplain {
+			m.explainView.Width, m.explainView.Height = m.execViewportSize()
+			m.explainView.SetContent(m.explainContent())
+		}
+		if m.execRun != nil {
+			width, height := m.execViewportSize()
+			m.execView.Width, m.execView.Height = width, height
+			if !m.execRun.done {
+				pty.Setsize(m.execRun.pty, &pty.Winsize{Rows: uint16(height), Cols: uint16(width)})
+			}
+		}
 		return m, nil
 	case tickMsg:
 		if m.running {
@@ -252,13 +314,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case responseMsg:
 		return m.handleResponse(msg)
+	case streamLineMsg:
+		return m.handleStreamLine(msg)
+	case compareResultMsg:
+		return m.handleCompareResult(msg)
+	case explainResultMsg:
+		return m.handleExplainResult(msg)
+	case editorFinishedMsg:
+		return m.handleEditorFinished(msg)
+	case ptyOutputMsg, ptyExitMsg, ptyTickMsg:
+		return m.handlePTYMsg(msg)
 	case execResultMsg:
 		if msg.err != nil {
 			m.running = false
 			m.mode = modeViewing
-			m.status = fmt.Sprintf("❌ exec failed: %v • %s", msg.err, helpViewing)
+			m.status = fmt.Sprintf("%s exec failed: %v • %s: ask AI to fix • %s", m.theme.glyphs.fail, msg.err, firstKey(m.keys.Fix), m.helpViewing())
 			m.lastError = msg.err
 			m.execOutput = msg.output
+			m.lastFailure = &failedRun{command: msg.command, exitCode: exitCodeOf(msg.err), output: msg.output, err: msg.err}
 			return m, nil
 		}
 		if msg.exit {
@@ -267,7 +340,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.running = false
 		m.mode = modeViewing
 		m.execOutput = msg.output
-		m.status = "command finished • " + helpViewing
+		m.status = "command finished • " + m.helpViewing()
 		return m, nil
 	case tea.KeyMsg:
 		return m.handleKeyMsg(msg)
@@ -281,11 +354,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.adjustTextareaHeight()
 		return m, cmd
 	}
+	if m.mode == modeHistory {
+		var cmd tea.Cmd
+		m.historyQuery, cmd = m.historyQuery.Update(msg)
+		return m, cmd
+	}
+	if m.mode == modeConfirm {
+		var cmd tea.Cmd
+		m.confirmInput, cmd = m.confirmInput.Update(msg)
+		return m, cmd
+	}
+	if m.mode == modeParams {
+		var cmd tea.Cmd
+		m.paramInputs[m.paramFocus], cmd = m.paramInputs[m.paramFocus].Update(msg)
+		return m, cmd
+	}
+	if m.mode == modeEdit {
+		var cmd tea.Cmd
+		m.editInput, cmd = m.editInput.Update(msg)
+		return m, cmd
+	}
 
 	return m, nil
 }
 
 func (m model) handleResponse(msg responseMsg) (tea.Model, tea.Cmd) {
+	if msg.id != m.requestID {
+		return m, nil
+	}
+	m.cancelRequest = nil
 	m.running = false
 	m.mode = modeViewing
 
@@ -298,16 +395,11 @@ func (m model) handleResponse(msg responseMsg) (tea.Model, tea.Cmd) {
 	m.lastError = nil
 	m.execOutput = ""
 
-	if sessionID := extractSessionID(respText); sessionID != "" {
-		if m.sessionIDs == nil {
-			m.sessionIDs = map[string]string{}
-		}
-		m.sessionIDs[msg.cli] = sessionID
-	}
+	m.captureSession(msg.cli, respText)
 
 	if msg.err != nil {
 		m.lastError = msg.err
-		m.status = fmt.Sprintf("error from %s: %v • %s", msg.cli, msg.err, helpViewing)
+		m.status = fmt.Sprintf("error from %s: %v • %s", msg.cli, msg.err, m.helpViewing())
 		m.options = nil
 		m.selected = 0
 		return m, nil
@@ -316,26 +408,44 @@ func (m model) handleResponse(msg responseMsg) (tea.Model, tea.Cmd) {
 	opts, parseErr := extractOptions(respText)
 	if parseErr != nil {
 		m.lastParseError = parseErr
-		m.status = fmt.Sprintf("parse error: %v • %s", parseErr, helpViewing)
+		m.status = fmt.Sprintf("parse error: %v • %s", parseErr, m.helpViewing())
 		m.options = nil
 		m.selected = 0
 		return m, nil
 	}
 
+	// Keep the selection made while options were streaming in.
+	if m.selected < 0 || m.selected >= len(opts) {
+		m.selected = 0
+	}
 	m.options = opts
-	m.selected = 0
-	m.status = helpViewing
+	m.status = m.helpViewing()
+	m.saveCurrentSession(msg.cli)
+	m.storeResponse(msg.cli, opts)
 
 	if m.autoExecute && len(opts) > 0 {
-		value := opts[0].Value
-		m.status = fmt.Sprintf("running: %s", cleanText(value))
 		m.autoExecute = false
-		return m, execWithFeedback(value, !m.stayOpenExec, m.stayOpenExec)
+		return m.useOption(opts[0], actionExecuted)
 	}
 
 	return m, nil
 }
 
+// captureSession remembers the session ID found in a provider's output so
+// the next refine can resume it.
+func (m *model) captureSession(cli, raw string) {
+	p, ok := lookupProvider(m.providers, cli)
+	if !ok {
+		return
+	}
+	if sessionID := sessionIDFor(p, raw); sessionID != "" {
+		if m.sessionIDs == nil {
+			m.sessionIDs = map[string]string{}
+		}
+		m.sessionIDs[cli] = sessionID
+	}
+}
+
 func (m model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch m.mode {
 	case modeInput:
@@ -346,6 +456,22 @@ func (m model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleRunningKeys(msg)
 	case modeViewing:
 		return m.handleViewingKeys(msg)
+	case modeHistory:
+		return m.handleHistoryKeys(msg)
+	case modeConfirm:
+		return m.handleConfirmKeys(msg)
+	case modeParams:
+		return m.handleParamKeys(msg)
+	case modeEdit:
+		return m.handleEditKeys(msg)
+	case modePreview:
+		return m.handlePreviewKeys(msg)
+	case modeExec:
+		return m.handleExecKeys(msg)
+	case modeExplain:
+		return m.handleExplainKeys(msg)
+	case modeHelp:
+		return m.handleHelpKeys(msg)
 	default:
 		return m, nil
 	}
@@ -358,11 +484,11 @@ func (m model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 
 	if msg.Y == 0 {
 		layout := m.headerLayout()
-		currentHelp := helpInput
+		currentHelp := m.helpInput()
 		if m.mode == modeViewing {
-			currentHelp = helpViewing
+			currentHelp = m.helpViewing()
 		} else if m.mode == modeRefine {
-			currentHelp = helpRefine
+			currentHelp = m.helpRefine()
 		}
 		for _, reg := range layout.cliRegions {
 			if msg.X >= reg.startX && msg.X < reg.endX {
@@ -371,10 +497,18 @@ func (m model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 		}
+		if msg.X >= layout.modeRegion.startX && msg.X < layout.modeRegion.endX && m.mode == modeInput {
+			m.cycleMode()
+			return m, nil
+		}
 		if msg.X >= layout.yoloRegion.startX && msg.X < layout.yoloRegion.endX {
 			m.toggleYolo()
 			return m, nil
 		}
+		if msg.X >= layout.contextRegion.startX && msg.X < layout.contextRegion.endX {
+			m.toggleContext()
+			return m, nil
+		}
 	}
 
 	if m.mode == modeViewing || m.mode == modeRefine {
@@ -388,29 +522,61 @@ func (m model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if msg.Type == tea.KeyCtrlC || msg.String() == "esc" {
+	if msg.Type == tea.KeyCtrlC || key.Matches(msg, m.keys.Exit) {
 		return m, tea.Quit
 	}
-	if msg.Type == tea.KeyCtrlY || msg.String() == "ctrl+y" {
+	// A printable help key only opens help before anything is typed.
+	if key.Matches(msg, m.keys.Help) && (msg.Type != tea.KeyRunes || m.input.Value() == "") {
+		return m.openHelp()
+	}
+	if key.Matches(msg, m.keys.Yolo) {
 		m.toggleYolo()
 		return m, nil
 	}
-	// ctrl-p = previous (left), ctrl-n = next (right)
-	if msg.Type == tea.KeyCtrlP {
+	if key.Matches(msg, m.keys.PrevCLI) {
 		m.prevCLI()
 		return m, nil
 	}
-	if msg.Type == tea.KeyCtrlN {
+	if key.Matches(msg, m.keys.NextCLI) {
 		m.nextCLI()
 		return m, nil
 	}
+	if key.Matches(msg, m.keys.History) {
+		return m.openHistory()
+	}
+	if key.Matches(msg, m.keys.Compare) && m.mode == modeInput {
+		m.toggleCompare()
+		return m, nil
+	}
+	if key.Matches(msg, m.keys.Mode) && m.mode == modeInput {
+		m.cycleMode()
+		return m, nil
+	}
+	if key.Matches(msg, m.keys.Context) {
+		m.toggleContext()
+		return m, nil
+	}
+	if key.Matches(msg, m.keys.Preview) {
+		return m.openPreview()
+	}
+	// Up/down recall past prompts while the input is a single line.
+	if m.mode == modeInput && (m.historyIndex >= 0 || !strings.Contains(m.input.Value(), "\n")) {
+		switch msg.String() {
+		case "up":
+			m.cycleHistory(-1)
+			return m, nil
+		case "down":
+			m.cycleHistory(1)
+			return m, nil
+		}
+	}
 	// Handle tab key - insert tab character
 	if msg.Type == tea.KeyTab {
 		var cmd tea.Cmd
 		m.input, cmd = m.input.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'\t'}})
 		return m, cmd
 	}
-	if isNewline(msg) {
+	if key.Matches(msg, m.keys.Newline) {
 		currentLines := strings.Count(m.input.Value(), "\n") + 1
 		newLines := currentLines + 1
 		if newLines <= 10 {
@@ -421,11 +587,11 @@ func (m model) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.input, cmd = m.input.Update(tea.KeyMsg{Type: tea.KeyEnter})
 		return m, cmd
 	}
-	if isCtrlR(msg) {
+	if key.Matches(msg, m.keys.SendRun) {
 		m.autoExecute = true
 		return m.submitPrompt()
 	}
-	if msg.Type == tea.KeyEnter || isCtrlEnter(msg) {
+	if key.Matches(msg, m.keys.Send) {
 		m.autoExecute = false
 		return m.submitPrompt()
 	}
@@ -434,33 +600,35 @@ func (m model) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 func (m model) handleViewingKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch {
-	case msg.Type == tea.KeyCtrlC || msg.String() == "esc" || msg.String() == "q":
+	case msg.Type == tea.KeyCtrlC || key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
-	case msg.Type == tea.KeyCtrlY || msg.String() == "ctrl+y":
+	case key.Matches(msg, m.keys.Help):
+		return m.openHelp()
+	case key.Matches(msg, m.keys.Yolo):
 		m.toggleYolo()
 		return m, nil
-	case msg.String() == "a":
-		sessionID := m.sessionIDs[m.currentCLI().name]
-		if sessionID == "" {
-			m.status = "no session to refine yet • " + helpViewing
+	case key.Matches(msg, m.keys.Refine):
+		sessionID := m.sessionIDs[m.currentCLI().name()]
+		if sessionID == "" || !m.currentCLI().caps().resume {
+			m.status = "no session to refine yet • " + m.helpViewing()
 			return m, nil
 		}
 		m.mode = modeRefine
 		m.running = false
 		m.input.SetValue("")
 		m.input.Focus()
-		m.status = helpRefine
+		m.status = m.helpRefine()
 		m.selected = -1
 		m.autoExecute = false
 		m.pendingResumeID = sessionID
 		m.adjustTextareaHeight()
 		return m, nil
-	case msg.String() == "n":
+	case key.Matches(msg, m.keys.NewPrompt):
 		m.mode = modeInput
 		m.running = false
 		m.input.SetValue("")
 		m.input.Focus()
-		m.status = helpInput
+		m.status = m.helpInput()
 		m.options = nil
 		m.lastParseError = nil
 		m.rawOutput = ""
@@ -473,61 +641,127 @@ func (m model) handleViewingKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.lastError = nil
 		m.adjustTextareaHeight()
 		return m, nil
-	case isNewline(msg):
+	case key.Matches(msg, m.keys.Newline):
 		m.mode = modeInput
 		m.running = false
 		m.input.SetValue("")
 		m.input.Focus()
-		m.status = helpInput
+		m.status = m.helpInput()
 		m.options = nil
 		m.lastParseError = nil
 		m.rawOutput = ""
 		m.autoExecute = false
 		m.execOutput = ""
 		return m, nil
-	case isCtrlR(msg):
-		value := m.selectedValue()
-		if value == "" {
-			if m.rawOutput == "" {
-				m.status = "nothing to run • " + helpViewing
-				return m, nil
-			}
-			value = m.rawOutput
+	case key.Matches(msg, m.keys.Run):
+		opt, ok := m.targetOption()
+		if !ok {
+			m.status = "nothing to run • " + m.helpViewing()
+			return m, nil
 		}
-		m.status = fmt.Sprintf("running: %s", cleanText(value))
-		m.execOutput = ""
-		return m, execWithFeedback(value, !m.stayOpenExec, m.stayOpenExec)
-	case msg.Type == tea.KeyEnter:
-		value := m.selectedValue()
-		if value == "" {
-			if m.rawOutput == "" {
-				m.status = "nothing to copy • " + helpViewing
-				return m, nil
-			}
-			value = m.rawOutput
+		return m.useOption(opt, actionExecuted)
+	case key.Matches(msg, m.keys.Copy):
+		opt, ok := m.targetOption()
+		if !ok {
+			m.status = "nothing to copy • " + m.helpViewing()
+			return m, nil
 		}
-		if err := clipboard.WriteAll(value); err != nil {
-			m.status = fmt.Sprintf("❌ CLIPBOARD FAILED: %v • Install xclip/xsel on Linux • %s", err, helpViewing)
+		return m.useOption(opt, actionCopied)
+	case key.Matches(msg, m.keys.Fix) && m.lastFailure != nil:
+		return m.requestFix()
+	case key.Matches(msg, m.keys.Edit, m.keys.EditExternal):
+		opt, ok := m.targetOption()
+		if !ok {
+			m.status = "nothing to edit • " + m.helpViewing()
 			return m, nil
 		}
-		m.status = fmt.Sprintf("✅ Copied to clipboard: %s", value)
-		return m, tea.Quit
-	case msg.String() == "up" || msg.String() == "k":
+		if key.Matches(msg, m.keys.EditExternal) {
+			m.editSource = opt
+			return m, openEditor(opt.Value)
+		}
+		return m.openEdit(opt, opt.Value)
+	case key.Matches(msg, m.keys.Explain):
+		opt, ok := m.targetOption()
+		if !ok {
+			m.status = "nothing to explain • " + m.helpViewing()
+			return m, nil
+		}
+		return m.openExplain(opt.Value)
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refresh()
+	case key.Matches(msg, m.keys.Up):
 		m.moveSelection(-1)
-	case msg.String() == "down" || msg.String() == "j":
+	case key.Matches(msg, m.keys.Down):
 		m.moveSelection(1)
 	}
 	return m, nil
 }
 
 func (m model) handleRunningKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// Only allow quitting while running
-	if msg.Type == tea.KeyCtrlC || msg.String() == "esc" {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		m.stopRequest()
 		return m, tea.Quit
+	case msg.String() == "esc":
+		return m.cancelRunning(), nil
+	}
+
+	// Options that streamed in early can be used without waiting for the
+	// provider to finish.
+	if len(m.options) == 0 {
+		return m, nil
+	}
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		m.moveSelection(-1)
+	case key.Matches(msg, m.keys.Down):
+		m.moveSelection(1)
+	case key.Matches(msg, m.keys.Copy):
+		m = m.finishEarly()
+		return m.useOption(m.options[m.selected], actionCopied)
+	case key.Matches(msg, m.keys.Run):
+		m = m.finishEarly()
+		return m.useOption(m.options[m.selected], actionExecuted)
 	}
 	return m, nil
 }
 
+// stopRequest kills the in-flight provider process, if any, and makes sure
+// its response is ignored when it arrives.
+func (m *model) stopRequest() {
+	if m.cancelRequest != nil {
+		m.cancelRequest()
+		m.cancelRequest = nil
+	}
+	m.requestID++
+}
+
+// cancelRunning abandons the in-flight request and puts its prompt back in
+// the input so it can be fixed and resent. A cancelled refine or fix stays
+// on its session, so sending it again continues the conversation.
+func (m model) cancelRunning() model {
+	m.stopRequest()
+	m.running = false
+	m.autoExecute = false
+	m.input.Focus()
+	if m.pendingResumeID != "" && len(m.promptHistory) > 0 {
+		last := len(m.promptHistory) - 1
+		m.input.SetValue(m.promptHistory[last])
+		m.promptHistory = m.promptHistory[:last]
+		m.mode = modeRefine
+		m.selected = -1
+		m.status = "cancelled • " + m.helpRefine()
+	} else {
+		m.input.SetValue(m.lastPrompt)
+		m.mode = modeInput
+		m.status = "cancelled • " + m.helpInput()
+		m.pendingResumeID = ""
+		m.promptHistory = nil
+	}
+	m.adjustTextareaHeight()
+	return m
+}
+
 func (m *model) toggleYolo() {
 	m.yolo = !m.yolo
 }
@@ -593,6 +827,9 @@ type optionRenderLines struct {
 
 type optionRenderLine struct {
 	prefix    string
+	badge     string
+	risk      riskLevel
+	providers string // compare-mode badge naming the providers
 	value     string
 	comment   string
 	highlight bool
@@ -669,7 +906,7 @@ func (m model) optionLines(opt optionEntry, selected bool) optionRenderLines {
 		totalWidth = 30
 	}
 
-	prefixSelected := "▶ "
+	prefixSelected := m.theme.glyphs.selected + " "
 	prefixNormal := "  "
 	prefixWidth := runewidth.StringWidth(prefixSelected)
 	if pw := runewidth.StringWidth(prefixNormal); pw > prefixWidth {
@@ -683,11 +920,20 @@ func (m model) optionLines(opt optionEntry, selected bool) optionRenderLines {
 	value := cleanText(opt.Value)
 	desc := strings.TrimSpace(cleanText(opt.Description))
 
-	combined := value
+	risk := m.optionRisk(opt)
+	badge := m.theme.glyphs.riskBadge(risk.level)
+	badgeLen := len([]rune(badge))
+	providers := ""
+	if len(opt.Providers) > 0 {
+		providers = "[" + strings.Join(opt.Providers, "+") + "] "
+	}
+	providersLen := len([]rune(providers))
+
+	combined := badge + providers + value
 	commentStart := -1
 	if desc != "" {
 		combined += "  # " + desc
-		commentStart = len([]rune(value)) + 2 // point to '#'
+		commentStart = badgeLen + providersLen + len([]rune(value)) + 2 // point to '#'
 	}
 
 	wrapped := wrapWithStarts(combined, textWidth)
@@ -718,8 +964,26 @@ func (m model) optionLines(opt optionEntry, selected bool) optionRenderLines {
 			commentText = string(lineRunes[commentIdx:])
 		}
 
+		badgeText := ""
+		if i == 0 && badgeLen > 0 {
+			valueRunes := []rune(valueText)
+			n := min(badgeLen, len(valueRunes))
+			badgeText = string(valueRunes[:n])
+			valueText = string(valueRunes[n:])
+		}
+		providersText := ""
+		if i == 0 && providersLen > 0 {
+			valueRunes := []rune(valueText)
+			n := min(providersLen, len(valueRunes))
+			providersText = string(valueRunes[:n])
+			valueText = string(valueRunes[n:])
+		}
+
 		lines = append(lines, optionRenderLine{
 			prefix:    prefix,
+			badge:     badgeText,
+			risk:      risk.level,
+			providers: providersText,
 			value:     valueText,
 			comment:   commentText,
 			highlight: selected && strings.TrimSpace(valueText) != "",
@@ -754,9 +1018,9 @@ func (m model) submitPrompt() (tea.Model, tea.Cmd) {
 	userPrompt := strings.TrimRight(m.input.Value(), "\n")
 	if strings.TrimSpace(userPrompt) == "" {
 		if m.mode == modeRefine {
-			m.status = "prompt is empty • " + helpRefine
+			m.status = "prompt is empty • " + m.helpRefine()
 		} else {
-			m.status = "prompt is empty • " + helpInput
+			m.status = "prompt is empty • " + m.helpInput()
 		}
 		return m, nil
 	}
@@ -769,70 +1033,102 @@ func (m model) submitPrompt() (tea.Model, tea.Cmd) {
 	}
 
 	m.lastPrompt = userPrompt
+	m.historyIndex = -1
+	m.historyDraft = ""
+	m.recordHistory("", "")
 	combinedPrompt := strings.Join(m.promptHistory, "\n")
 	promptContent := combinedPrompt
 	if wasRefine {
 		// For resume flows, only send the new prompt; the session carries prior context.
 		promptContent = userPrompt
 	}
-	fullPrompt := buildPrompt(promptContent)
+	if !wasRefine {
+		return m.requestOptions(promptContent, true)
+	}
+	return m.startRequest(m.promptFor(promptContent, true), m.pendingResumeID)
+}
+
+// startRequest sends fullPrompt to the current provider, resuming sessionID
+// when set, and shows the spinner until the response arrives.
+func (m model) startRequest(fullPrompt, sessionID string) (tea.Model, tea.Cmd) {
 	m.running = true
 	m.mode = modeRunning
 	m.spinnerFrame = 0
-	m.status = ""
+	m.status = helpRunning
 	m.options = nil
 	m.lastParseError = nil
 	m.lastError = nil
 	m.rawOutput = ""
 	m.execOutput = ""
 	m.selected = 0
-	sessionID := ""
-	if wasRefine {
-		sessionID = m.pendingResumeID
-	}
-	m.pendingResumeID = ""
+	m.lastFailure = nil
+	m.pendingResumeID = sessionID
+	m.requestContent = ""
+	m.cacheKey = ""
+	m.cachedAt = time.Time{}
+	m.streamRaw = ""
+	m.streamActivity = ""
+	m.streamTokens = 0
 
 	selectedCLI := m.currentCLI()
-	cliName := selectedCLI.name
+	req := providerRequest{prompt: fullPrompt, yolo: m.yolo, schema: m.schema}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.timeout)
+	m.requestID++
+	m.cancelRequest = cancel
+	if m.compare && sessionID == "" {
+		m, cmds := m.startCompare(ctx, fullPrompt)
+		m.resizeComponents()
+		return m, tea.Batch(append(cmds, tickCmd)...)
+	}
+	// A single-provider run, such as a refine after comparing, drops the
+	// compare marks of the previous run.
+	m.compareState = nil
+
+	id := m.requestID
+	// Progress lines are best-effort: when the UI falls behind they are
+	// dropped rather than stalling the provider, since the full output
+	// arrives with the response anyway.
+	events := make(chan tea.Msg, 256)
+	req.onLine = func(line string) {
+		select {
+		case events <- streamLineMsg{id: id, line: line, events: events}:
+		default:
+		}
+	}
 	cmd := func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
-		runPrompt := selectedCLI.runPrompt
-		if sessionID != "" && selectedCLI.resumePrompt != nil {
-			runPrompt = func(ctx context.Context, prompt string, yolo bool) ([]byte, error) {
-				return selectedCLI.resumePrompt(ctx, prompt, sessionID, yolo)
-			}
-		}
-		out, err := runPrompt(ctx, fullPrompt, m.yolo)
+		out, err := sendPrompt(ctx, selectedCLI, req, sessionID)
+		close(events)
 		return responseMsg{
+			id:     id,
 			output: out,
 			err:    err,
-			cli:    cliName,
+			cli:    selectedCLI.name(),
 		}
 	}
 
 	m.resizeComponents()
-	return m, tea.Batch(cmd, tickCmd)
+	return m, tea.Batch(cmd, tickCmd, waitStream(events))
 }
 
 func (m *model) nextCLI() {
-	if len(m.cliOptions) == 0 {
+	if len(m.providers) == 0 {
 		return
 	}
-	m.cliIndex = (m.cliIndex + 1) % len(m.cliOptions)
-	m.status = helpInput
+	m.cliIndex = (m.cliIndex + 1) % len(m.providers)
+	m.status = m.helpInput()
 }
 
 func (m *model) prevCLI() {
-	if len(m.cliOptions) == 0 {
+	if len(m.providers) == 0 {
 		return
 	}
-	m.cliIndex = (m.cliIndex - 1 + len(m.cliOptions)) % len(m.cliOptions)
-	m.status = helpInput
+	m.cliIndex = (m.cliIndex - 1 + len(m.providers)) % len(m.providers)
+	m.status = m.helpInput()
 }
 
-func (m model) currentCLI() cliOption {
-	return m.cliOptions[m.cliIndex]
+func (m model) currentCLI() provider {
+	return m.providers[m.cliIndex]
 }
 
 func (m *model) resizeComponents() {
@@ -845,70 +1141,80 @@ func (m *model) resizeComponents() {
 	}
 }
 
-func isNewline(msg tea.KeyMsg) bool {
-	if msg.Type == tea.KeyCtrlJ {
-		return true
-	}
-	if msg.Type == tea.KeyEnter && msg.Alt {
-		return true
+func (m *model) moveSelection(delta int) {
+	if len(m.options) == 0 {
+		return
 	}
-	return msg.String() == "alt+enter"
+	m.selected = (m.selected + delta + len(m.options)) % len(m.options)
 }
 
-func isCtrlR(msg tea.KeyMsg) bool {
-	return msg.Type == tea.KeyCtrlR || msg.String() == "ctrl+r"
+func (m model) selectedValue() string {
+	opt, _ := m.selectedOption()
+	return opt.Value
 }
 
-func isCtrlEnter(msg tea.KeyMsg) bool {
-	return msg.String() == "ctrl+enter"
+// useOption copies or runs opt, asking for its parameters first.
+func (m model) useOption(opt optionEntry, action string) (tea.Model, tea.Cmd) {
+	if len(optionParameters(opt)) > 0 {
+		return m.openParamForm(opt, action)
+	}
+	if action == actionExecuted {
+		return m.runChecked(opt)
+	}
+	return m.copyValue(opt.Value)
 }
 
-func (m *model) moveSelection(delta int) {
-	if len(m.options) == 0 {
-		return
+// targetOption returns the option Enter, Ctrl+R and e/E act on: the
+// selection, or the raw output when nothing could be parsed.
+func (m model) targetOption() (optionEntry, bool) {
+	if opt, ok := m.selectedOption(); ok {
+		return opt, true
 	}
-	m.selected = (m.selected + delta + len(m.options)) % len(m.options)
+	if m.rawOutput != "" {
+		return optionEntry{Value: m.rawOutput}, true
+	}
+	return optionEntry{}, false
 }
 
-func (m model) selectedValue() string {
-	if len(m.options) == 0 {
-		return ""
-	}
+func (m model) selectedOption() (optionEntry, bool) {
 	if m.selected < 0 || m.selected >= len(m.options) {
-		return ""
+		return optionEntry{}, false
 	}
-	return m.options[m.selected].Value
+	return m.options[m.selected], true
 }
 
 func (m model) renderOptionsTable() string {
 	if len(m.options) == 0 {
-		noOptsStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color(grayColor)).
+		noOptsStyle := m.theme.fg(m.theme.muted).
 			Italic(true)
 		return noOptsStyle.Render("(no options)")
 	}
 
 	var rows []string
 
-	selectedStyle := lipgloss.NewStyle().
-		Background(lipgloss.Color("62")).
-		Foreground(lipgloss.Color("230")).
+	selectedStyle := m.theme.fill(m.theme.selectedBG, m.theme.selectedFG).
 		Bold(true)
 
-	normalStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("15"))
+	normalStyle := m.theme.fg(m.theme.text)
+
+	commentStyle := m.theme.fg(m.theme.muted)
 
-	commentStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color(grayColor))
+	providersStyle := m.theme.fg(m.theme.info)
 
 	for i, opt := range m.options {
 		lines := m.optionLines(opt, i == m.selected)
 		for _, ln := range lines.lines {
-			base := ln.prefix + ln.value
-			if ln.highlight {
-				base = selectedStyle.Render(base)
+			var base string
+			if ln.badge != "" || ln.providers != "" {
+				style := normalStyle
+				if ln.highlight {
+					style = selectedStyle
+				}
+				base = style.Render(ln.prefix) + m.theme.riskStyle(ln.risk).Render(ln.badge) + providersStyle.Render(ln.providers) + style.Render(ln.value)
+			} else if ln.highlight {
+				base = selectedStyle.Render(ln.prefix + ln.value)
 			} else {
-				base = normalStyle.Render(base)
+				base = normalStyle.Render(ln.prefix + ln.value)
 			}
 
 			if strings.TrimSpace(ln.comment) == "" {
@@ -924,8 +1230,7 @@ func (m model) renderOptionsTable() string {
 }
 
 func (m model) renderPromptHistory() string {
-	promptStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("12")).
+	promptStyle := m.theme.fg(m.theme.prompt).
 		Bold(true)
 
 	if len(m.promptHistory) == 0 && strings.TrimSpace(m.lastPrompt) == "" {
@@ -934,14 +1239,14 @@ func (m model) renderPromptHistory() string {
 
 	var sb strings.Builder
 	if len(m.promptHistory) > 0 {
-		sb.WriteString(promptStyle.Render("❯ " + m.promptHistory[0]))
+		sb.WriteString(promptStyle.Render(m.theme.glyphs.prompt + " " + m.promptHistory[0]))
 		sb.WriteString("\n")
 		for _, p := range m.promptHistory[1:] {
-			sb.WriteString(promptStyle.Render("↳ " + p))
+			sb.WriteString(promptStyle.Render(m.theme.glyphs.continued + " " + p))
 			sb.WriteString("\n")
 		}
 	} else {
-		sb.WriteString(promptStyle.Render("❯ " + m.lastPrompt))
+		sb.WriteString(promptStyle.Render(m.theme.glyphs.prompt + " " + m.lastPrompt))
 		sb.WriteString("\n")
 	}
 
@@ -950,11 +1255,8 @@ func (m model) renderPromptHistory() string {
 
 func (m model) renderInputArea() string {
 	inputBoxStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.AdaptiveColor{
-			Light: "201",
-			Dark:  "51",
-		}).
+		Border(m.theme.glyphs.border).
+		BorderForeground(m.theme.border).
 		Padding(0, 1)
 
 	totalLines := strings.Count(m.input.Value(), "\n") + 1
@@ -963,12 +1265,12 @@ func (m model) renderInputArea() string {
 
 	var scrollIndicator string
 	if hasScroll {
-		indicatorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("201"))
+		indicatorStyle := m.theme.fg(m.theme.accent)
 		scrollLines := make([]string, visibleHeight+2)
-		scrollLines[0] = "▲"
-		scrollLines[len(scrollLines)-1] = "▼"
+		scrollLines[0] = m.theme.glyphs.scrollUp
+		scrollLines[len(scrollLines)-1] = m.theme.glyphs.scrollEnd
 		for i := 1; i < len(scrollLines)-1; i++ {
-			scrollLines[i] = "│"
+			scrollLines[i] = m.theme.glyphs.scrollBar
 		}
 		scrollIndicator = indicatorStyle.Render(strings.Join(scrollLines, "\n"))
 	}
@@ -995,20 +1297,20 @@ func (m model) renderInputArea() string {
 func (m model) buildHeader() (string, headerMeta) {
 	var meta headerMeta
 
-	logoStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	titleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true)
-	separatorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(grayColor))
-	keyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true)
-	descStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(grayColor))
+	logoStyle := m.theme.fg(m.theme.accent)
+	titleStyle := m.theme.fg(m.theme.accent).Bold(true)
+	separatorStyle := m.theme.fg(m.theme.muted)
+	keyStyle := m.theme.fg(m.theme.accent).Bold(true)
+	descStyle := m.theme.fg(m.theme.muted)
 
-	selectedCLIStyle := lipgloss.NewStyle().
-		Background(lipgloss.Color("205")).
-		Foreground(lipgloss.Color("0")).
+	selectedCLIStyle := m.theme.fill(m.theme.accent, m.theme.onAccent).
 		Bold(true).
 		Padding(0, 1)
 
-	normalCLIStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color(grayColor)).
+	normalCLIStyle := m.theme.fg(m.theme.muted).
+		Padding(0, 1)
+
+	compareCLIStyle := m.theme.fg(m.theme.accent).
 		Padding(0, 1)
 
 	toggleStyle := lipgloss.NewStyle().
@@ -1023,7 +1325,7 @@ func (m model) buildHeader() (string, headerMeta) {
 	var leftSide strings.Builder
 	cursor := 0
 
-	logo := logoStyle.Render("✨ ")
+	logo := logoStyle.Render(m.theme.glyphs.logo + " ")
 	leftSide.WriteString(logo)
 	cursor += lipgloss.Width(logo)
 
@@ -1031,19 +1333,25 @@ func (m model) buildHeader() (string, headerMeta) {
 	leftSide.WriteString(title)
 	cursor += lipgloss.Width(title)
 
-	sep := separatorStyle.Render(" • ")
+	sep := separatorStyle.Render(" " + m.theme.glyphs.bullet + " ")
 	leftSide.WriteString(sep)
 	cursor += lipgloss.Width(sep)
 
-	for i, opt := range m.cliOptions {
+	for i, p := range m.providers {
 		if i > 0 {
 			p := separatorStyle.Render(" | ")
 			leftSide.WriteString(p)
 			cursor += lipgloss.Width(p)
 		}
-		tab := normalCLIStyle.Render(opt.name)
+		label := p.name()
+		if m.compare && containsFold(providerNames(m.compareProviders()), p.name()) {
+			label = m.compareMark(p.name()) + label
+		}
+		tab := normalCLIStyle.Render(label)
 		if i == m.cliIndex {
-			tab = selectedCLIStyle.Render(opt.name)
+			tab = selectedCLIStyle.Render(label)
+		} else if m.compare && label != p.name() {
+			tab = compareCLIStyle.Render(label)
 		}
 		start := cursor
 		cursor += lipgloss.Width(tab)
@@ -1061,25 +1369,58 @@ func (m model) buildHeader() (string, headerMeta) {
 	leftSide.WriteString(space)
 	cursor += lipgloss.Width(space)
 
-	ctrlHint := keyStyle.Render("ctrl+n/p")
+	ctrlHint := keyStyle.Render(m.keys.cliHint())
 	leftSide.WriteString(ctrlHint)
 	cursor += lipgloss.Width(ctrlHint)
 
+	modeKey := descStyle.Render("  ") + keyStyle.Render(firstKey(m.keys.Mode)) + descStyle.Render(" ")
+	leftSide.WriteString(modeKey)
+	cursor += lipgloss.Width(modeKey)
+	modeStyle := normalCLIStyle
+	if _, ok := m.currentMode(); ok {
+		modeStyle = compareCLIStyle.Bold(true)
+	}
+	modeTab := modeStyle.Render(m.modeLabel())
+	leftSide.WriteString(modeTab)
+	meta.modeRegion = clickRegion{kind: "mode", startX: cursor, endX: cursor + lipgloss.Width(modeTab), y: 0}
+	cursor += lipgloss.Width(modeTab)
+
+	if !m.cachedAt.IsZero() && m.mode == modeViewing {
+		cachedStyle := m.theme.fg(m.theme.info).Bold(true).Padding(0, 1)
+		leftSide.WriteString(" " + cachedStyle.Render("cached "+m.theme.glyphs.dot+" "+since(m.cachedAt, time.Now())))
+	}
+
 	leftWidth := lipgloss.Width(leftSide.String())
 
 	yoloState := "off"
 	if m.yolo {
 		yoloState = "on"
 	}
+	if !m.currentCLI().caps().yolo {
+		yoloState = "n/a"
+	}
 
-	if m.yolo {
-		toggleStyle = toggleStyle.Background(lipgloss.Color("205")).Foreground(lipgloss.Color("0"))
+	if m.yolo && m.currentCLI().caps().yolo {
+		toggleStyle = toggleStyle.Inherit(m.theme.fill(m.theme.accent, m.theme.onAccent))
 	} else {
-		toggleStyle = toggleStyle.Foreground(lipgloss.Color(grayColor))
+		toggleStyle = toggleStyle.Inherit(m.theme.fg(m.theme.muted))
 	}
 
+	contextStyle := lipgloss.NewStyle().Padding(0, 1).Bold(true)
+	contextState := "off"
+	if m.useContext {
+		contextState = "on"
+		contextStyle = contextStyle.Inherit(m.theme.fill(m.theme.info, m.theme.onAccent))
+	} else {
+		contextStyle = contextStyle.Inherit(m.theme.fg(m.theme.muted))
+	}
+	contextKey := keyStyle.Render(firstKey(m.keys.Context)) + descStyle.Render(" ")
+	contextText := contextStyle.Render("ctx: " + contextState)
+
+	yoloKey := keyStyle.Render(firstKey(m.keys.Yolo)) + descStyle.Render(" ")
 	toggleText := toggleStyle.Render("yolo: " + yoloState)
-	rightSide := keyStyle.Render("ctrl+y") + descStyle.Render(" ") + toggleText
+	gap := descStyle.Render("  ")
+	rightSide := contextKey + contextText + gap + yoloKey + toggleText
 	rightWidth := lipgloss.Width(rightSide)
 
 	spacing := ""
@@ -1091,9 +1432,16 @@ func (m model) buildHeader() (string, headerMeta) {
 
 	header := leftSide.String() + spacing + rightSide
 
+	contextStart := leftWidth + lipgloss.Width(spacing) + lipgloss.Width(contextKey)
+	meta.contextRegion = clickRegion{
+		kind:   "context",
+		startX: contextStart,
+		endX:   contextStart + lipgloss.Width(contextText),
+		y:      0,
+	}
 	meta.yoloRegion = clickRegion{
 		kind:   "yolo",
-		startX: lipgloss.Width(leftSide.String()) + lipgloss.Width(spacing) + lipgloss.Width(keyStyle.Render("ctrl+y")+descStyle.Render(" ")),
+		startX: meta.contextRegion.endX + lipgloss.Width(gap) + lipgloss.Width(yoloKey),
 		endX:   lipgloss.Width(header),
 		y:      0,
 	}
@@ -1109,10 +1457,9 @@ func (m model) headerLayout() headerMeta {
 
 func (m model) View() string {
 	if !m.ready {
-		loadingStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
+		loadingStyle := m.theme.fg(m.theme.accent).
 			Bold(true)
-		return loadingStyle.Render("⏳ Loading...")
+		return loadingStyle.Render(m.theme.glyphs.loading + " Loading...")
 	}
 
 	var b strings.Builder
@@ -1121,15 +1468,27 @@ func (m model) View() string {
 	b.WriteString(header)
 	b.WriteString("\n")
 
-	if m.running {
+	if m.mode == modeHistory {
+		b.WriteString(m.renderHistoryOverlay())
+	} else if m.mode == modePreview {
+		b.WriteString(m.renderPreview())
+	} else if m.mode == modeExec {
+		b.WriteString(m.renderExec())
+	} else if m.mode == modeExplain {
+		b.WriteString(m.renderExplain())
+	} else if m.mode == modeHelp {
+		b.WriteString(m.renderHelp())
+	} else if m.running {
 		// Show spinner animation
-		spinnerFrames := []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
-		spinner := spinnerFrames[m.spinnerFrame%len(spinnerFrames)]
+		spinner := m.theme.glyphs.spin(m.spinnerFrame)
 
-		spinnerStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("10")).
+		spinnerStyle := m.theme.fg(m.theme.success).
 			Bold(true)
-		b.WriteString(spinnerStyle.Render(fmt.Sprintf("%s Running %s...", spinner, m.currentCLI().name)))
+		if m.compareState != nil {
+			b.WriteString(spinnerStyle.Render(fmt.Sprintf("%s Comparing %s...", spinner, strings.Join(providerNames(m.compareProviders()), ", "))))
+		} else {
+			b.WriteString(spinnerStyle.Render(fmt.Sprintf("%s Running %s...", spinner, m.currentCLI().name())))
+		}
 		b.WriteString("\n")
 		if ph := strings.TrimSuffix(m.renderPromptHistory(), "\n"); ph != "" {
 			b.WriteString(ph)
@@ -1139,58 +1498,54 @@ func (m model) View() string {
 			b.WriteString(m.renderOptionsTable())
 			b.WriteString("\n")
 		}
-	} else if m.mode == modeViewing || m.mode == modeRefine {
+	} else if m.mode == modeViewing || m.mode == modeRefine || m.mode == modeConfirm || m.mode == modeParams || m.mode == modeEdit {
 		if ph := strings.TrimSuffix(m.renderPromptHistory(), "\n"); ph != "" {
 			b.WriteString(ph)
 			b.WriteString("\n")
 		}
 
 		if m.lastError != nil {
-			errorStyle := lipgloss.NewStyle().
-				Foreground(lipgloss.Color("9")).
+			errorStyle := m.theme.fg(m.theme.failure).
 				Bold(true)
-			b.WriteString(errorStyle.Render(fmt.Sprintf("❌ Error: %v", m.lastError)))
+			b.WriteString(errorStyle.Render(fmt.Sprintf("%s Error: %v", m.theme.glyphs.fail, m.lastError)))
 			b.WriteString("\n")
 			if m.rawOutput != "" {
-				rawStyle := lipgloss.NewStyle().
-					Foreground(lipgloss.Color(grayColor))
+				rawStyle := m.theme.fg(m.theme.muted)
 				b.WriteString(rawStyle.Render(m.rawOutput))
 				b.WriteString("\n")
 			}
 		} else if m.lastParseError != nil {
-			errorStyle := lipgloss.NewStyle().
-				Foreground(lipgloss.Color("9")).
+			errorStyle := m.theme.fg(m.theme.failure).
 				Bold(true)
-			b.WriteString(errorStyle.Render(fmt.Sprintf("❌ Parse error: %v", m.lastParseError)))
+			b.WriteString(errorStyle.Render(fmt.Sprintf("%s Parse error: %v", m.theme.glyphs.fail, m.lastParseError)))
 			b.WriteString("\n")
 			if m.rawOutput != "" {
-				rawStyle := lipgloss.NewStyle().
-					Foreground(lipgloss.Color(grayColor))
+				rawStyle := m.theme.fg(m.theme.muted)
 				b.WriteString(rawStyle.Render(m.rawOutput))
 				b.WriteString("\n")
 			}
 		} else if len(m.options) == 0 {
-			warnStyle := lipgloss.NewStyle().
-				Foreground(lipgloss.Color("11")).
+			warnStyle := m.theme.fg(m.theme.warning).
 				Bold(true)
-			b.WriteString(warnStyle.Render("⚠ No options returned"))
+			b.WriteString(warnStyle.Render(m.theme.glyphs.warn + " No options returned"))
 			b.WriteString("\n")
 		} else {
 			b.WriteString(m.renderOptionsTable())
 			b.WriteString("\n")
 			// Add horizontal divider before status line
-			dividerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(grayColor))
+			dividerStyle := m.theme.fg(m.theme.muted)
 			dividerWidth := m.width - 10
 			if dividerWidth < 20 {
 				dividerWidth = 20
 			}
-			b.WriteString(dividerStyle.Render(strings.Repeat("─", dividerWidth)))
+			b.WriteString(dividerStyle.Render(strings.Repeat(m.theme.glyphs.rule, dividerWidth)))
 			b.WriteString("\n")
+			b.WriteString(m.renderOptionDetail())
 		}
 
 		if strings.TrimSpace(m.execOutput) != "" {
-			outputLabel := lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
-			outputText := lipgloss.NewStyle().Foreground(lipgloss.Color(grayColor))
+			outputLabel := m.theme.fg(m.theme.info).Bold(true)
+			outputText := m.theme.fg(m.theme.muted)
 			b.WriteString(outputLabel.Render("Command output:"))
 			b.WriteString("\n")
 			b.WriteString(outputText.Render(m.execOutput))
@@ -1200,105 +1555,58 @@ func (m model) View() string {
 		if m.mode == modeRefine {
 			b.WriteString(m.renderInputArea())
 		}
+		if m.mode == modeConfirm {
+			b.WriteString(m.renderConfirm())
+		}
+		if m.mode == modeParams {
+			b.WriteString(m.renderParamForm())
+		}
+		if m.mode == modeEdit {
+			b.WriteString(m.renderEdit())
+		}
 	} else {
 		b.WriteString(m.renderInputArea())
 	}
 
 	if m.status != "" {
+		descStyle := m.theme.fg(m.theme.muted)
+
+		b.WriteString(descStyle.Render(m.theme.glyphs.hint + " "))
+
 		// Style keyboard shortcuts differently from descriptions
-		keyStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
-			Bold(true)
-		sepStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color(grayColor))
-		descStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color(grayColor))
-
-		b.WriteString(descStyle.Render("💡 "))
-
-		// Build styled help text based on current status
-		if m.status == helpInput {
-			b.WriteString(keyStyle.Render("enter"))
-			b.WriteString(descStyle.Render(": send "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+r"))
-			b.WriteString(descStyle.Render(": send & run "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+y"))
-			b.WriteString(descStyle.Render(": toggle yolo "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("alt+enter"))
-			b.WriteString(descStyle.Render("/"))
-			b.WriteString(keyStyle.Render("ctrl+j"))
-			b.WriteString(descStyle.Render(": newline "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("esc"))
-			b.WriteString(descStyle.Render(": exit"))
-		} else if m.status == helpViewing {
-			b.WriteString(keyStyle.Render("enter"))
-			b.WriteString(descStyle.Render(": copy & exit "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+r"))
-			b.WriteString(descStyle.Render(": run & exit "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("a"))
-			b.WriteString(descStyle.Render(": refine "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("n"))
-			b.WriteString(descStyle.Render(": new prompt "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+y"))
-			b.WriteString(descStyle.Render(": toggle yolo "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("esc"))
-			b.WriteString(descStyle.Render("/"))
-			b.WriteString(keyStyle.Render("q"))
-			b.WriteString(descStyle.Render(": quit"))
-		} else if m.status == helpRefine {
-			b.WriteString(keyStyle.Render("enter"))
-			b.WriteString(descStyle.Render(": refine "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+r"))
-			b.WriteString(descStyle.Render(": refine & run "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("ctrl+y"))
-			b.WriteString(descStyle.Render(": toggle yolo "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("alt+enter"))
-			b.WriteString(descStyle.Render("/"))
-			b.WriteString(keyStyle.Render("ctrl+j"))
-			b.WriteString(descStyle.Render(": newline "))
-			b.WriteString(sepStyle.Render("• "))
-			b.WriteString(keyStyle.Render("esc"))
-			b.WriteString(descStyle.Render(": exit"))
+		if entries := m.statusHelp(); entries != nil {
+			b.WriteString(m.theme.helpLine(entries))
 		} else {
 			// For other status messages, just render as-is
-			b.WriteString(descStyle.Render(m.status))
+			b.WriteString(descStyle.Render(m.theme.glyphs.text(m.status)))
 		}
 	}
 
 	return b.String()
 }
 
-func execWithFeedback(value string, exitOnSuccess bool, stayOpenExec bool) tea.Cmd {
-	if stayOpenExec {
-		return func() tea.Msg {
-			cmd := exec.Command("sh", "-c", value)
-			out, err := cmd.CombinedOutput()
-			return execResultMsg{err: err, exit: false, output: string(out)}
-		}
+// execute runs value: inside a PTY in the TUI with -stay-open-exec, or
+// handing the terminal over to it and exiting on success otherwise.
+func (m model) execute(value string) (tea.Model, tea.Cmd) {
+	if m.stayOpenExec {
+		return m.startPTY(value)
 	}
+	return m, execWithFeedback(value)
+}
 
+func execWithFeedback(value string) tea.Cmd {
+	// Keep the tail of the output so a failure can be sent back for a fix.
+	tail := &tailBuffer{limit: fixOutputLimit}
 	cmd := exec.Command("sh", "-c", value)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
 	cmd.Stdin = os.Stdin
 
 	return tea.ExecProcess(cmd, func(err error) tea.Msg {
 		if err != nil {
-			return execResultMsg{err: err, exit: false}
+			return execResultMsg{err: err, exit: false, output: tail.String(), command: value}
 		}
-		return execResultMsg{exit: exitOnSuccess}
+		return execResultMsg{exit: true}
 	})
 }
 